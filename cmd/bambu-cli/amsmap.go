@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"bambu-cli/internal/printer"
+	"bambu-cli/internal/threemf"
+	"bambu-cli/internal/ui"
+)
+
+// loadJobProject inspects the 3MF a print start refers to: the local file,
+// or the copy on the printer with --no-upload.
+func loadJobProject(res ResolvedPrinter, inputPath string, onPrinter bool) (*threemf.Project, error) {
+	var proj *threemf.Project
+	var err error
+	if onPrinter {
+		proj, err = openRemoteProject(res, inputPath)
+	} else {
+		proj, err = threemf.Open(inputPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", inputPath, err)
+	}
+	return proj, nil
+}
+
+// jobMapping resolves the AMS mapping for a plate: the explicit
+// --ams-mapping when given, otherwise the plate's filaments matched to the
+// trays loaded on the printer. An automatic mapping is printed to stderr.
+func jobMapping(gf GlobalFlags, report printer.PrintReport, plate *threemf.Plate, explicit []int) (*printer.AMSMapping, error) {
+	m, err := planMapping(report, plate, explicit)
+	if err != nil || m == nil {
+		return m, err
+	}
+	if explicit == nil && (!gf.Quiet || len(m.Missing) > 0 || askMapping(gf)) {
+		writeAMSMapping(*m)
+	}
+	return m, nil
+}
+
+// askMapping reports whether an automatic mapping is confirmed before the
+// print starts: only when someone at a terminal can answer and --force was
+// not given.
+func askMapping(gf GlobalFlags) bool {
+	return !gf.Force && !gf.NoInput && ui.IsTerminal(os.Stdin)
+}
+
+// confirmMapping asks the user to accept the mapping jobMapping printed.
+func confirmMapping(gf GlobalFlags) error {
+	return ui.RequireConfirmation(ui.ConfirmOptions{
+		Action:  "print",
+		Confirm: gf.Confirm,
+		UseTTY:  true,
+		Out:     os.Stderr,
+	})
+}
+
+// planMapping is jobMapping without the output. The result is nil when an
+// explicit mapping cannot be checked because the plate lists no filaments.
+func planMapping(report printer.PrintReport, plate *threemf.Plate, explicit []int) (*printer.AMSMapping, error) {
+	if len(plate.Filaments) == 0 {
+		if explicit != nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("plate %d lists no filaments; is it sliced? (pass --ams-mapping to set the mapping by hand)", plate.Index)
+	}
+	trays := printer.LoadedTrays(report.AMS, report.VTTray)
+	reqs := filamentRequests(plate.Filaments)
+	var m printer.AMSMapping
+	if explicit != nil {
+		m = printer.MappingFromIndices(reqs, trays, explicit)
+	} else {
+		m = printer.MapFilaments(reqs, trays)
+	}
+	return &m, nil
+}
+
+func filamentRequests(filaments []threemf.Filament) []printer.FilamentRequest {
+	reqs := make([]printer.FilamentRequest, 0, len(filaments))
+	for _, f := range filaments {
+		reqs = append(reqs, printer.FilamentRequest{Slot: f.ID, Type: f.Type, Color: f.Color})
+	}
+	return reqs
+}
+
+func writeAMSMapping(m printer.AMSMapping) {
+	fmt.Fprintln(os.Stderr, "AMS mapping:")
+	for _, c := range m.Choices {
+		note := "exact color"
+		switch {
+		case c.TypeMismatch:
+			note = "MATERIAL NOT LOADED"
+		case c.Distance > 0:
+			note = "nearest color"
+		}
+		fmt.Fprintf(os.Stderr, "  slot %d %s %s -> %s %s #%s (%s)\n",
+			c.Request.Slot, c.Request.Type, c.Request.Color, c.Tray.Label(), c.Tray.Type, rgbHex(c.Tray.Color), note)
+	}
+	fmt.Fprintf(os.Stderr, "  --ams-mapping %s\n", joinInts(m.Mapping))
+}
+
+// rgbHex drops the alpha byte from a tray colour ("RRGGBBAA").
+func rgbHex(color string) string {
+	if len(color) == 8 {
+		return color[:6]
+	}
+	return color
+}
+
+func joinInts(v []int) string {
+	parts := make([]string, 0, len(v))
+	for _, n := range v {
+		parts = append(parts, fmt.Sprint(n))
+	}
+	return strings.Join(parts, ",")
+}
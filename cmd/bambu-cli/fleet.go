@@ -0,0 +1,423 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"bambu-cli/internal/output"
+	"bambu-cli/internal/printer"
+)
+
+func cmdFleet(gf GlobalFlags, args []string) int {
+	if len(args) == 0 {
+		printCommandUsage("fleet")
+		return 2
+	}
+	sub := args[0]
+	subargs := args[1:]
+	switch sub {
+	case "status":
+		return cmdFleetStatus(gf, subargs)
+	case "print":
+		return cmdFleetPrint(gf, subargs)
+	default:
+		printCommandUsage("fleet")
+		return 2
+	}
+}
+
+// fleetRow is one printer in fleet output. Status is nil when the printer
+// could not be reached.
+type fleetRow struct {
+	Printer   string          `json:"printer"`
+	Reachable bool            `json:"reachable"`
+	Error     string          `json:"error,omitempty"`
+	ETA       *time.Time      `json:"eta,omitempty"`
+	Status    *printer.Status `json:"status,omitempty"`
+}
+
+func cmdFleetStatus(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("fleet status", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	workers := fs.Int("workers", 4, "printers queried at once")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	names, err := fleetProfiles(gf)
+	if err != nil {
+		return errExit(err)
+	}
+
+	rows := make([]fleetRow, len(names))
+	forEachPrinter(gf, names, *workers, func(i int, pgf GlobalFlags) {
+		rows[i] = fleetStatusRow(pgf)
+	})
+
+	code := 0
+	for _, r := range rows {
+		if !r.Reachable {
+			code = 1
+		}
+	}
+	switch selectFormat(gf) {
+	case output.JSON:
+		if err := output.WriteJSON(os.Stdout, rows); err != nil {
+			return errExit(err)
+		}
+	case output.Plain:
+		for _, r := range rows {
+			fmt.Fprintln(os.Stdout, strings.Join(fleetCells(r, time.RFC3339), "\t"))
+		}
+	default:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PRINTER\tSTATE\tPROGRESS\tLAYER\tETA\tBED\tNOZZLE\tERROR")
+		for _, r := range rows {
+			fmt.Fprintln(tw, strings.Join(fleetCells(r, "15:04"), "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return errExit(err)
+		}
+	}
+	return code
+}
+
+// fleetProfiles lists the configured profiles by name.
+func fleetProfiles(gf GlobalFlags) ([]string, error) {
+	cfg, _, err := loadMergedConfig(gf)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no printer profiles configured; add one with config set")
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// profileFlags returns global flags selecting the profile name. Flags and
+// environment variables naming a single printer (--ip, BAMBU_IP, --serial,
+// access code, ports) are dropped.
+func profileFlags(gf GlobalFlags, name string) GlobalFlags {
+	gf.IP, gf.Serial, gf.AccessCodeFile, gf.AccessCodeStdin = "", "", "", false
+	gf.ProfileOnly = true
+	gf.Printer = name
+	return gf
+}
+
+// forEachPrinter runs fn for every profile with at most workers running at
+// once. fn gets global flags selecting that profile (see profileFlags).
+func forEachPrinter(gf GlobalFlags, names []string, workers int, fn func(i int, pgf GlobalFlags)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(names); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i, profileFlags(gf, names[i]))
+			}
+		}()
+	}
+	for i := range names {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+func fleetStatusRow(gf GlobalFlags) fleetRow {
+	row := fleetRow{Printer: gf.Printer}
+	res, err := resolvePrinter(gf, true, true)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	client, err := dialMQTT(res)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	defer client.Close()
+	_ = client.PushAll()
+	if err := client.WaitForData(res.Timeout); err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	status := printer.GetStatus(client)
+	row.Reachable = true
+	row.Status = &status
+	if status.RemainingMinutes != nil && isActive(status.GcodeState) {
+		eta := time.Now().Add(time.Duration(*status.RemainingMinutes) * time.Minute).Round(time.Minute)
+		row.ETA = &eta
+	}
+	return row
+}
+
+// fleetCells are the table columns for a row.
+func fleetCells(r fleetRow, etaLayout string) []string {
+	if r.Status == nil {
+		return []string{r.Printer, "unreachable", "-", "-", "-", "-", "-", r.Error}
+	}
+	s := r.Status
+	eta := "-"
+	if r.ETA != nil {
+		eta = r.ETA.Format(etaLayout)
+	}
+	problem := "-"
+	switch {
+	case s.Error != nil:
+		problem = s.Error.Hex
+		if s.Error.Description != "" {
+			problem += " " + s.Error.Description
+		}
+	case len(s.HMS) > 0:
+		problem = formatHMSAlert(s.HMS[0])
+		if len(s.HMS) > 1 {
+			problem += fmt.Sprintf(" (+%d more)", len(s.HMS)-1)
+		}
+	}
+	return []string{
+		r.Printer,
+		string(s.GcodeState),
+		strconv.Itoa(s.Percent) + "%",
+		fmt.Sprintf("%d/%d", s.LayerCurrent, s.LayerTotal),
+		eta,
+		fmtFloat(s.BedTemp),
+		fmtFloat(s.NozzleTemp),
+		problem,
+	}
+}
+
+// Fleet dispatch policies.
+const (
+	policyFirst    = "first"    // first eligible profile by name
+	policyRandom   = "random"   // any eligible profile
+	policyFilament = "filament" // the most filament to spare on the trays used
+)
+
+// fleetCandidate is one printer considered by fleet print.
+type fleetCandidate struct {
+	Printer  string           `json:"printer"`
+	Eligible bool             `json:"eligible"`
+	Reasons  []string         `json:"reasons,omitempty"`
+	Checks   []preflightCheck `json:"checks,omitempty"`
+	// spare is the smallest filament margin in grams over the trays the job
+	// uses, for the filament policy.
+	spare float64
+}
+
+func cmdFleetPrint(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("fleet print", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	policy := fs.String("policy", policyFirst, "how to choose among eligible printers: first, random or filament")
+	workers := fs.Int("workers", 4, "printers queried at once")
+	o := addPrintStartFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	if fs.NArg() < 1 {
+		return errExit(errors.New("fleet print requires a file path"))
+	}
+	switch *policy {
+	case policyFirst, policyRandom, policyFilament:
+	default:
+		return errExit(fmt.Errorf("unknown policy %q (want first, random or filament)", *policy))
+	}
+	if *o.noUpload {
+		return errExit(errors.New("fleet print uploads the file; --no-upload is not supported"))
+	}
+	inputPath := fs.Arg(0)
+	var explicit []int
+	if *o.amsMapping != "" {
+		var err error
+		if explicit, err = parseIntList(*o.amsMapping); err != nil {
+			return errExit(err)
+		}
+	}
+
+	job := preflightJob{}
+	if strings.HasSuffix(strings.ToLower(inputPath), ".3mf") {
+		proj, err := loadJobProject(ResolvedPrinter{}, inputPath, false)
+		if err != nil {
+			return errExit(err)
+		}
+		plate, ok := proj.Plate(plateNumber(plateToLocation(*o.plate)))
+		if !ok {
+			return errExit(fmt.Errorf("%s has no plate %s", inputPath, *o.plate))
+		}
+		job.Model, job.Plate = proj.PrinterModel, plate
+	} else if _, err := os.Stat(inputPath); err != nil {
+		return errExit(err)
+	}
+
+	names, err := fleetProfiles(gf)
+	if err != nil {
+		return errExit(err)
+	}
+	candidates := make([]fleetCandidate, len(names))
+	forEachPrinter(gf, names, *workers, func(i int, pgf GlobalFlags) {
+		candidates[i] = evaluateCandidate(pgf, job, !*o.noAMS, explicit)
+	})
+
+	chosen := chooseCandidate(candidates, *policy)
+	if err := writeFleetChoice(gf, candidates, chosen, *policy); err != nil {
+		return errExit(err)
+	}
+	if chosen < 0 {
+		return errExit(errors.New("no printer can take this job"))
+	}
+	if gf.DryRun {
+		fmt.Fprintf(os.Stdout, "Would start print for %s on %s\n", inputPath, candidates[chosen].Printer)
+		return 0
+	}
+
+	// Hand over to print start with the same options; it re-runs the
+	// pre-flight checks against the chosen printer before uploading.
+	var startArgs []string
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "policy" && f.Name != "workers" {
+			startArgs = append(startArgs, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return cmdPrintStart(profileFlags(gf, candidates[chosen].Printer), append(startArgs, inputPath))
+}
+
+// evaluateCandidate runs the pre-flight checks, plus an HMS health check,
+// for one printer.
+func evaluateCandidate(gf GlobalFlags, job preflightJob, useAMS bool, explicit []int) fleetCandidate {
+	c := fleetCandidate{Printer: gf.Printer}
+	reject := func(reason string) fleetCandidate {
+		c.Reasons = append(c.Reasons, reason)
+		return c
+	}
+	res, err := resolvePrinter(gf, true, true)
+	if err != nil {
+		return reject(err.Error())
+	}
+	client, err := dialMQTT(res)
+	if err != nil {
+		return reject("unreachable: " + err.Error())
+	}
+	defer client.Close()
+	_ = client.PushAll()
+	if err := client.WaitForData(res.Timeout); err != nil {
+		return reject("unreachable: " + err.Error())
+	}
+	report := client.Report()
+	if job.Plate != nil && useAMS {
+		if job.Mapping, err = planMapping(report, job.Plate, explicit); err != nil {
+			return reject(err.Error())
+		}
+	}
+
+	c.Checks = append(preflightChecks(res, report, job), healthCheck(report))
+	for _, check := range c.Checks {
+		if check.Status == checkFail {
+			c.Reasons = append(c.Reasons, check.Name+": "+check.Detail)
+		}
+	}
+	c.Eligible = len(c.Reasons) == 0
+	c.spare = filamentSpare(job)
+	return c
+}
+
+// filamentSpare is the smallest margin between filament left and filament
+// needed over the trays a job uses. Trays that don't report what is left
+// count as no margin.
+func filamentSpare(job preflightJob) float64 {
+	if job.Mapping == nil || job.Plate == nil {
+		return 0
+	}
+	needed := map[int]float64{}
+	for _, c := range job.Mapping.Choices {
+		needed[c.Tray.Index] += gramsForSlot(job.Plate, c.Request.Slot)
+	}
+	spare := math.Inf(1)
+	for _, c := range job.Mapping.Choices {
+		left, known := c.Tray.RemainingGrams()
+		margin := 0.0
+		if known {
+			margin = left - needed[c.Tray.Index]
+		}
+		spare = math.Min(spare, margin)
+	}
+	if math.IsInf(spare, 1) {
+		return 0
+	}
+	return spare
+}
+
+// chooseCandidate returns the index of the printer picked by policy, or -1.
+func chooseCandidate(candidates []fleetCandidate, policy string) int {
+	var eligible []int
+	for i, c := range candidates {
+		if c.Eligible {
+			eligible = append(eligible, i)
+		}
+	}
+	if len(eligible) == 0 {
+		return -1
+	}
+	switch policy {
+	case policyRandom:
+		return eligible[rand.Intn(len(eligible))]
+	case policyFilament:
+		best := eligible[0]
+		for _, i := range eligible[1:] {
+			if candidates[i].spare > candidates[best].spare {
+				best = i
+			}
+		}
+		return best
+	default:
+		return eligible[0]
+	}
+}
+
+func writeFleetChoice(gf GlobalFlags, candidates []fleetCandidate, chosen int, policy string) error {
+	name := ""
+	if chosen >= 0 {
+		name = candidates[chosen].Printer
+	}
+	switch selectFormat(gf) {
+	case output.JSON:
+		return output.WriteJSON(os.Stdout, map[string]any{"chosen": name, "policy": policy, "candidates": candidates})
+	case output.Plain:
+		for _, c := range candidates {
+			fmt.Fprintf(os.Stdout, "%s\t%t\t%t\t%s\n", c.Printer, c.Printer == name, c.Eligible, strings.Join(c.Reasons, "; "))
+		}
+		return nil
+	default:
+		fmt.Fprintln(os.Stderr, "Printers:")
+		for _, c := range candidates {
+			switch {
+			case c.Printer == name:
+				fmt.Fprintf(os.Stderr, "  %-12s chosen (policy %s)\n", c.Printer, policy)
+			case c.Eligible:
+				fmt.Fprintf(os.Stderr, "  %-12s eligible\n", c.Printer)
+			default:
+				fmt.Fprintf(os.Stderr, "  %-12s rejected: %s\n", c.Printer, strings.Join(c.Reasons, "; "))
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"bambu-cli/internal/output"
+	"bambu-cli/internal/printer"
+	"bambu-cli/internal/ui"
+)
+
+// followStartTimeout bounds how long print start --follow waits for the
+// printer to pick up the job (it downloads and parses the file first).
+const followStartTimeout = 3 * time.Minute
+
+// followPrint streams progress of the job just started until it finishes,
+// recording the outcome in the history. It returns 0 on FINISH,
+// exitPrintFailed on FAILED and exitPrintStopped when the job was cancelled.
+func followPrint(gf GlobalFlags, client *printer.MQTTClient, rec *jobRecorder) int {
+	events, unsubscribe := client.Subscribe(64)
+	defer unsubscribe()
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	f := &follower{gf: gf, tty: ui.IsTerminal(os.Stdout) && selectFormat(gf) == output.Human}
+	defer f.endLine()
+
+	// The report still shows the previous job until the printer accepts the
+	// new one; don't read its FINISH as this job's result.
+	startDeadline := time.NewTimer(followStartTimeout)
+	defer startDeadline.Stop()
+	started := false
+	lastConn := printer.ConnConnected
+	for {
+		conn := client.Connection()
+		if conn.State != lastConn {
+			f.endLine()
+			if err := writeConnection(gf, conn); err != nil {
+				return errExit(err)
+			}
+			lastConn = conn.State
+		}
+		if conn.State == printer.ConnConnected {
+			status := printer.GetStatus(client)
+			if !started && isActive(status.GcodeState) {
+				started = true
+				startDeadline.Stop()
+			}
+			if started {
+				rec.observe(status)
+				if err := f.render(status); err != nil {
+					return errExit(err)
+				}
+				if code, done := f.result(status); done {
+					return code
+				}
+			}
+		}
+
+		select {
+		case ev := <-events:
+			if ev.Type == printer.EventHMSRaised && ev.HMS != nil {
+				for _, a := range printer.DecodeHMS([]printer.HMSEntry{*ev.HMS}) {
+					f.alert(a)
+				}
+			}
+		case <-ticker.C:
+		case <-startDeadline.C:
+			if !started {
+				fmt.Fprintf(os.Stderr, "Error: printer did not start the job within %s\n", followStartTimeout)
+				return exitTimeout
+			}
+		}
+	}
+}
+
+func isActive(state printer.GcodeState) bool {
+	switch state {
+	case printer.GcodeStatePrepare, printer.GcodeStateRunning, printer.GcodeStatePause:
+		return true
+	}
+	return false
+}
+
+type follower struct {
+	gf       GlobalFlags
+	tty      bool
+	last     string
+	lineOpen bool
+}
+
+// render shows the status when it changed. On a terminal the progress line is
+// redrawn in place.
+func (f *follower) render(status printer.Status) error {
+	line := progressLine(status, time.Now())
+	if line == f.last {
+		return nil
+	}
+	f.last = line
+	switch selectFormat(f.gf) {
+	case output.JSON:
+		return output.WriteJSON(os.Stdout, status)
+	case output.Plain:
+		kv := statusKV(status)
+		kv["timestamp"] = time.Now().Format(time.RFC3339)
+		kv["eta"] = formatETA(status, time.Now(), time.RFC3339)
+		return output.WritePlainKV(os.Stdout, kv)
+	default:
+		if f.tty {
+			fmt.Fprintf(os.Stdout, "\r\033[K%s", line)
+			f.lineOpen = true
+		} else {
+			fmt.Fprintln(os.Stdout, line)
+		}
+		return nil
+	}
+}
+
+// alert reports a newly raised HMS alert. JSON and plain output carry alerts
+// in the status records instead.
+func (f *follower) alert(a printer.HMSAlert) {
+	if selectFormat(f.gf) != output.Human {
+		return
+	}
+	f.endLine()
+	fmt.Fprintf(os.Stdout, "HMS %s\n", formatHMSAlert(a))
+	f.last = ""
+}
+
+func (f *follower) endLine() {
+	if f.lineOpen {
+		fmt.Fprintln(os.Stdout)
+		f.lineOpen = false
+	}
+}
+
+// result decides whether the job has ended and with which exit code.
+func (f *follower) result(status printer.Status) (int, bool) {
+	var code int
+	var msg string
+	switch {
+	case status.GcodeState == printer.GcodeStateFinish:
+		msg = "Print finished"
+	case status.GcodeState == printer.GcodeStateFailed && status.ErrorCode == printer.PrintErrorCancelled,
+		status.GcodeState == printer.GcodeStateIdle:
+		code, msg = exitPrintStopped, "Print stopped"
+	case status.GcodeState == printer.GcodeStateFailed:
+		code, msg = exitPrintFailed, "Print failed"
+		if status.Error != nil {
+			msg += ": " + status.Error.Hex
+			if status.Error.Description != "" {
+				msg += " " + status.Error.Description
+			}
+		}
+	default:
+		return 0, false
+	}
+	f.endLine()
+	if selectFormat(f.gf) == output.JSON {
+		event := map[string]any{"event": "ended", "result": strings.ToLower(string(status.GcodeState)), "exit_code": code}
+		if err := output.WriteJSON(os.Stdout, event); err != nil {
+			return errExit(err), true
+		}
+		return code, true
+	}
+	if code == 0 {
+		if !f.gf.Quiet {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "Error:", msg)
+	}
+	return code, true
+}
+
+// progressLine renders e.g.
+// "[########------------]  42%  layer 12/50  printing  ETA 15:42".
+func progressLine(status printer.Status, now time.Time) string {
+	const width = 20
+	pct := status.Percent
+	if pct < 0 {
+		pct = 0
+	} else if pct > 100 {
+		pct = 100
+	}
+	filled := pct * width / 100
+	line := fmt.Sprintf("[%s%s] %3d%%  layer %d/%d  %s", strings.Repeat("#", filled), strings.Repeat("-", width-filled),
+		pct, status.LayerCurrent, status.LayerTotal, stageName(status))
+	if eta := formatETA(status, now, "15:04"); eta != "" {
+		line += "  ETA " + eta
+	}
+	return line
+}
+
+func stageName(status printer.Status) string {
+	if status.GcodeState == printer.GcodeStatePause && !strings.HasPrefix(status.PrintStatus, "PAUSED") {
+		return "paused"
+	}
+	if status.PrintStatus == "" || status.PrintStatus == "IDLE" {
+		return strings.ToLower(string(status.GcodeState))
+	}
+	return strings.ToLower(strings.ReplaceAll(status.PrintStatus, "_", " "))
+}
+
+// formatETA is the wall-clock time the job should finish, or "" when the
+// printer gives no estimate.
+func formatETA(status printer.Status, now time.Time, layout string) string {
+	if status.RemainingMinutes == nil || status.GcodeState == printer.GcodeStatePrepare {
+		return ""
+	}
+	return now.Add(time.Duration(*status.RemainingMinutes) * time.Minute).Round(time.Minute).Format(layout)
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"bambu-cli/internal/history"
+	"bambu-cli/internal/output"
+	"bambu-cli/internal/printer"
+	"bambu-cli/internal/threemf"
+)
+
+func cmdHistory(gf GlobalFlags, args []string) int {
+	if len(args) == 0 {
+		printCommandUsage("history")
+		return 2
+	}
+	sub := args[0]
+	subargs := args[1:]
+	switch sub {
+	case "list":
+		return cmdHistoryList(gf, subargs)
+	case "export":
+		return cmdHistoryExport(gf, subargs)
+	case "stats":
+		return cmdHistoryStats(gf, subargs)
+	default:
+		printCommandUsage("history")
+		return 2
+	}
+}
+
+// historyFilter selects records for the history subcommands.
+type historyFilter struct {
+	printer *string
+	outcome *string
+	since   *string
+}
+
+func addHistoryFilter(fs *flag.FlagSet) historyFilter {
+	return historyFilter{
+		printer: fs.String("printer", "", "only jobs on this profile"),
+		outcome: fs.String("outcome", "", "only jobs that ended so: finished, failed, stopped, unknown or running"),
+		since:   fs.String("since", "", "only jobs started after a date (2006-01-02) or within a duration (e.g. 168h)"),
+	}
+}
+
+// records reads the history and applies the filter, oldest first.
+func (f historyFilter) records(gf GlobalFlags) ([]history.Record, error) {
+	var since time.Time
+	if *f.since != "" {
+		var err error
+		if since, err = parseSince(*f.since, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	path, err := dataPath(gf, "history.json")
+	if err != nil {
+		return nil, err
+	}
+	h, err := history.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]history.Record, 0, len(h.Records))
+	for _, r := range h.Records {
+		if *f.printer != "" && r.Printer != *f.printer {
+			continue
+		}
+		if *f.outcome != "" && r.Outcome != *f.outcome {
+			continue
+		}
+		if r.Started.Before(since) {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q (want a date like 2006-01-02 or a duration)", s)
+	}
+	return now.Add(-d), nil
+}
+
+func cmdHistoryList(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("history list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	filter := addHistoryFilter(fs)
+	limit := fs.Int("limit", 20, "show at most this many of the latest jobs (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	records, err := filter.records(gf)
+	if err != nil {
+		return errExit(err)
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[len(records)-*limit:]
+	}
+
+	now := time.Now()
+	switch selectFormat(gf) {
+	case output.JSON:
+		return exitOnErr(output.WriteJSON(os.Stdout, map[string]any{"records": records}))
+	case output.Plain:
+		for _, r := range records {
+			fmt.Fprintln(os.Stdout, strings.Join(historyRow(r, time.RFC3339, now), "\t"))
+		}
+		return 0
+	default:
+		if len(records) == 0 {
+			fmt.Fprintln(os.Stdout, "No jobs recorded")
+			return 0
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTARTED\tPRINTER\tFILE\tPLATE\tOUTCOME\tDURATION\tFILAMENT")
+		for _, r := range records {
+			fmt.Fprintln(tw, strings.Join(historyRow(r, "2006-01-02 15:04", now), "\t"))
+		}
+		return exitOnErr(tw.Flush())
+	}
+}
+
+// historyRow are the list columns for a record.
+func historyRow(r history.Record, layout string, now time.Time) []string {
+	plate := "-"
+	if r.Plate > 0 {
+		plate = strconv.Itoa(r.Plate)
+	}
+	outcome := r.Outcome
+	if r.ErrorCode != 0 && r.Outcome == history.OutcomeFailed {
+		outcome += " " + printer.FormatPrintError(r.ErrorCode)
+	}
+	filament := "-"
+	if len(r.Filament) > 0 {
+		filament = fmt.Sprintf("%.1f g", r.FilamentGrams())
+	}
+	return []string{
+		strconv.Itoa(r.ID),
+		r.Started.Local().Format(layout),
+		r.Printer,
+		r.File,
+		plate,
+		outcome,
+		formatDuration(r.Duration(now)),
+		filament,
+	}
+}
+
+// formatDuration renders a job duration to the minute, e.g. "1h32m".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func cmdHistoryExport(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("history export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	filter := addHistoryFilter(fs)
+	format := fs.String("format", "csv", "csv or json")
+	out := fs.String("out", "-", "file to write (- for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	if *format != "csv" && *format != "json" {
+		return errExit(fmt.Errorf("unknown export format %q (want csv or json)", *format))
+	}
+	records, err := filter.records(gf)
+	if err != nil {
+		return errExit(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return errExit(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		return exitOnErr(output.WriteJSON(w, records))
+	}
+	return exitOnErr(writeHistoryCSV(w, records))
+}
+
+// writeHistoryCSV writes one row per job. Materials are listed as
+// "type:grams" pairs separated by semicolons.
+func writeHistoryCSV(w io.Writer, records []history.Record) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "printer", "file", "plate", "started", "ended", "outcome", "error_code", "duration_s", "filament_g", "materials", "observed"})
+	for _, r := range records {
+		ended, duration, errorCode := "", "", ""
+		if r.Ended != nil {
+			ended = r.Ended.Format(time.RFC3339)
+			duration = strconv.Itoa(int(r.Duration(time.Time{}).Seconds()))
+		}
+		if r.ErrorCode != 0 {
+			errorCode = printer.FormatPrintError(r.ErrorCode)
+		}
+		materials := make([]string, 0, len(r.Filament))
+		for _, f := range r.Filament {
+			materials = append(materials, f.Type+":"+strconv.FormatFloat(f.Grams, 'f', 2, 64))
+		}
+		_ = cw.Write([]string{
+			strconv.Itoa(r.ID),
+			r.Printer,
+			r.File,
+			strconv.Itoa(r.Plate),
+			r.Started.Format(time.RFC3339),
+			ended,
+			r.Outcome,
+			errorCode,
+			duration,
+			strconv.FormatFloat(r.FilamentGrams(), 'f', 2, 64),
+			strings.Join(materials, ";"),
+			strconv.FormatBool(r.Observed),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func cmdHistoryStats(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("history stats", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	filter := addHistoryFilter(fs)
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	records, err := filter.records(gf)
+	if err != nil {
+		return errExit(err)
+	}
+	stats := history.Summarize(records)
+
+	switch selectFormat(gf) {
+	case output.JSON:
+		return exitOnErr(output.WriteJSON(os.Stdout, map[string]any{"printers": stats}))
+	case output.Plain:
+		for _, s := range stats {
+			materials := make([]string, 0, len(s.Filament))
+			for _, t := range materialsByWeight(s.Filament) {
+				materials = append(materials, fmt.Sprintf("%s=%.1f", t, s.Filament[t]))
+			}
+			fmt.Fprintf(os.Stdout, "%s\t%d\t%d\t%d\t%d\t%.3f\t%.2f\t%s\n", s.Printer, s.Jobs, s.Finished, s.Failed, s.Stopped,
+				s.SuccessRate, s.PrintHours, strings.Join(materials, ","))
+		}
+		return 0
+	default:
+		if len(stats) == 0 {
+			fmt.Fprintln(os.Stdout, "No jobs recorded")
+			return 0
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PRINTER\tJOBS\tFINISHED\tFAILED\tSTOPPED\tSUCCESS\tHOURS\tFILAMENT")
+		for _, s := range stats {
+			success := "-"
+			if s.Finished+s.Failed+s.Stopped > 0 {
+				success = fmt.Sprintf("%.0f%%", s.SuccessRate*100)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t%.1f\t%s\n", s.Printer, s.Jobs, s.Finished, s.Failed, s.Stopped,
+				success, s.PrintHours, firstNonEmpty(formatMaterials(s.Filament), "-"))
+		}
+		return exitOnErr(tw.Flush())
+	}
+}
+
+// formatMaterials lists grams by material, heaviest first, e.g.
+// "PLA 812 g, PETG 120 g".
+func formatMaterials(grams map[string]float64) string {
+	parts := make([]string, 0, len(grams))
+	for _, t := range materialsByWeight(grams) {
+		parts = append(parts, fmt.Sprintf("%s %.0f g", t, grams[t]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func materialsByWeight(grams map[string]float64) []string {
+	types := make([]string, 0, len(grams))
+	for t := range grams {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if grams[types[i]] != grams[types[j]] {
+			return grams[types[i]] > grams[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// jobRecorder keeps the history of one printer up to date as jobs start and
+// end. A history that cannot be written never fails the command; it is
+// reported once as a warning.
+type jobRecorder struct {
+	path    string
+	printer string
+	// active is set once this process has seen the job running, so a
+	// finished job still on the printer from before isn't recorded again.
+	active bool
+	warned bool
+}
+
+func newJobRecorder(gf GlobalFlags, res ResolvedPrinter) *jobRecorder {
+	r := &jobRecorder{printer: firstNonEmpty(res.ProfileName, res.Serial, res.IP)}
+	path, err := dataPath(gf, "history.json")
+	if err != nil {
+		r.warn(err)
+		return r
+	}
+	r.path = path
+	return r
+}
+
+func (r *jobRecorder) update(fn func(h *history.History, now time.Time)) {
+	if r.path == "" {
+		return
+	}
+	h, err := history.Read(r.path)
+	if err == nil {
+		fn(&h, time.Now().UTC().Truncate(time.Second))
+		err = history.Save(r.path, h)
+	}
+	if err != nil {
+		r.warn(err)
+	}
+}
+
+func (r *jobRecorder) warn(err error) {
+	if !r.warned {
+		fmt.Fprintf(os.Stderr, "Warning: could not update the print history: %v\n", err)
+		r.warned = true
+	}
+}
+
+// started records a job print start has just sent. A job still open for the
+// printer ended without being seen.
+func (r *jobRecorder) started(rec history.Record) {
+	r.active = true
+	r.update(func(h *history.History, now time.Time) {
+		if open := h.Open(r.printer); open != nil {
+			open.Close(history.OutcomeUnknown, 0, now)
+		}
+		rec.Printer, rec.Started, rec.Outcome = r.printer, now, history.OutcomeRunning
+		h.Add(rec)
+	})
+}
+
+// observe records what a status report shows: a running job not yet in the
+// history, or the end of a job seen running.
+func (r *jobRecorder) observe(status printer.Status) {
+	if isActive(status.GcodeState) {
+		if r.active {
+			return
+		}
+		r.active = true
+		r.update(func(h *history.History, now time.Time) {
+			open := h.Open(r.printer)
+			if open != nil && (status.File == "" || path.Base(open.File) == path.Base(status.File)) {
+				return
+			}
+			if open != nil {
+				open.Close(history.OutcomeUnknown, 0, now)
+			}
+			h.Add(history.Record{
+				Printer:  r.printer,
+				File:     status.File,
+				Started:  now,
+				Outcome:  history.OutcomeRunning,
+				Observed: true,
+			})
+		})
+		return
+	}
+	outcome, ended := jobOutcome(status)
+	if !r.active || !ended {
+		return
+	}
+	r.active = false
+	r.update(func(h *history.History, now time.Time) {
+		if open := h.Open(r.printer); open != nil {
+			code := 0
+			if outcome == history.OutcomeFailed {
+				code = status.ErrorCode
+			}
+			open.Close(outcome, code, now)
+		}
+	})
+}
+
+// stopped records that print stop ended the running job.
+func (r *jobRecorder) stopped() {
+	r.update(func(h *history.History, now time.Time) {
+		if open := h.Open(r.printer); open != nil {
+			open.Close(history.OutcomeStopped, 0, now)
+		}
+	})
+}
+
+// jobOutcome is how a job ended, judged from the state the printer settled
+// in after it.
+func jobOutcome(status printer.Status) (string, bool) {
+	switch {
+	case status.GcodeState == printer.GcodeStateFinish:
+		return history.OutcomeFinished, true
+	case status.GcodeState == printer.GcodeStateFailed && status.ErrorCode == printer.PrintErrorCancelled,
+		status.GcodeState == printer.GcodeStateIdle:
+		return history.OutcomeStopped, true
+	case status.GcodeState == printer.GcodeStateFailed:
+		return history.OutcomeFailed, true
+	}
+	return "", false
+}
+
+// jobFilament is the slicer's filament estimate for a plate.
+func jobFilament(plate *threemf.Plate) []history.Filament {
+	var out []history.Filament
+	for _, f := range plate.Filaments {
+		if f.UsedGrams > 0 {
+			out = append(out, history.Filament{Type: f.Type, Color: f.Color, Grams: f.UsedGrams})
+		}
+	}
+	return out
+}
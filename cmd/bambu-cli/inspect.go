@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"bambu-cli/internal/output"
+	"bambu-cli/internal/printer"
+	"bambu-cli/internal/threemf"
+)
+
+func cmdPrintInspect(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("print inspect", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	remote := fs.Bool("remote", false, "inspect a file already on the printer")
+	plate := fs.Int("plate", 0, "only show this plate")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	if fs.NArg() < 1 {
+		return errExit(errors.New("print inspect requires a file path"))
+	}
+
+	var proj *threemf.Project
+	var err error
+	if *remote {
+		res, rerr := resolvePrinter(gf, true, false)
+		if rerr != nil {
+			return errExit(rerr)
+		}
+		proj, err = openRemoteProject(res, fs.Arg(0))
+	} else {
+		proj, err = threemf.Open(fs.Arg(0))
+	}
+	if err != nil {
+		return errExit(err)
+	}
+	if *plate != 0 {
+		p, ok := proj.Plate(*plate)
+		if !ok {
+			return errExit(fmt.Errorf("plate %d not found", *plate))
+		}
+		proj.Plates = []threemf.Plate{*p}
+	}
+
+	switch selectFormat(gf) {
+	case output.JSON:
+		return exitOnErr(output.WriteJSON(os.Stdout, proj))
+	case output.Plain:
+		writeProjectPlain(proj)
+		return 0
+	default:
+		writeProjectHuman(fs.Arg(0), proj)
+		return 0
+	}
+}
+
+// openRemoteProject downloads a 3MF from the printer's storage to a
+// temporary file and inspects it.
+func openRemoteProject(res ResolvedPrinter, remotePath string) (*threemf.Project, error) {
+	tmp, err := os.CreateTemp("", "bambu-inspect-*.3mf")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout, res.TLS)
+	if err := ftpClient.Download(remotePath, tmp); err != nil {
+		return nil, fmt.Errorf("download %s: %w", remotePath, err)
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return threemf.Read(tmp, info.Size())
+}
+
+func writeProjectHuman(name string, proj *threemf.Project) {
+	fmt.Fprintf(os.Stdout, "File: %s\n", name)
+	if proj.PrinterModel != "" {
+		fmt.Fprintf(os.Stdout, "Printer: %s\n", proj.PrinterModel)
+	}
+	if proj.SlicerVersion != "" {
+		fmt.Fprintf(os.Stdout, "Slicer: Bambu Studio %s\n", proj.SlicerVersion)
+	}
+	for _, p := range proj.Plates {
+		title := fmt.Sprintf("Plate %d", p.Index)
+		if p.Name != "" {
+			title += ": " + p.Name
+		}
+		if !p.Sliced {
+			title += " (not sliced)"
+		}
+		fmt.Fprintln(os.Stdout, "")
+		fmt.Fprintln(os.Stdout, title)
+		if p.Sliced {
+			fmt.Fprintf(os.Stdout, "  Time: %s  Weight: %.1f g\n", formatSeconds(p.PredictionSec), p.WeightGrams)
+		}
+		fmt.Fprintf(os.Stdout, "  Nozzle: %s mm  Bed: %s\n", fmtFloat(p.NozzleDiameter), firstNonEmpty(p.BedType, "unknown"))
+		if p.GcodeFile != "" {
+			fmt.Fprintf(os.Stdout, "  Gcode: %s\n", p.GcodeFile)
+		}
+		if p.Thumbnail != "" {
+			fmt.Fprintf(os.Stdout, "  Thumbnail: %s\n", p.Thumbnail)
+		}
+		if len(p.Objects) > 0 {
+			fmt.Fprintln(os.Stdout, "  Objects (id for --skip-objects):")
+			for _, o := range p.Objects {
+				line := fmt.Sprintf("    %-6d %s", o.ID, o.Name)
+				if o.Skipped {
+					line += " (skipped)"
+				}
+				fmt.Fprintln(os.Stdout, line)
+			}
+		}
+		if len(p.Filaments) > 0 {
+			fmt.Fprintln(os.Stdout, "  Filaments:")
+			for _, f := range p.Filaments {
+				fmt.Fprintf(os.Stdout, "    %-2d %-8s %-9s %.1f g\n", f.ID, f.Type, f.Color, f.UsedGrams)
+			}
+		}
+	}
+	if len(proj.Thumbnails) > 0 {
+		fmt.Fprintln(os.Stdout, "")
+		fmt.Fprintf(os.Stdout, "Thumbnails: %s\n", strings.Join(proj.Thumbnails, ", "))
+	}
+}
+
+// writeProjectPlain prints one tab-separated record per line, tagged with
+// its kind and plate index.
+func writeProjectPlain(proj *threemf.Project) {
+	for _, p := range proj.Plates {
+		fmt.Fprintf(os.Stdout, "plate\t%d\t%s\t%t\t%d\t%s\t%s\t%s\n", p.Index, p.Name, p.Sliced, p.PredictionSec,
+			strconv.FormatFloat(p.WeightGrams, 'f', 2, 64), fmtFloat(p.NozzleDiameter), p.BedType)
+		for _, o := range p.Objects {
+			fmt.Fprintf(os.Stdout, "object\t%d\t%d\t%s\n", p.Index, o.ID, o.Name)
+		}
+		for _, f := range p.Filaments {
+			fmt.Fprintf(os.Stdout, "filament\t%d\t%d\t%s\t%s\t%s\n", p.Index, f.ID, f.Type, f.Color, strconv.FormatFloat(f.UsedGrams, 'f', 2, 64))
+		}
+	}
+	for _, t := range proj.Thumbnails {
+		fmt.Fprintf(os.Stdout, "thumbnail\t%s\n", t)
+	}
+}
+
+// formatSeconds renders a duration in seconds as e.g. "1h23m" or "7m".
+func formatSeconds(sec int) string {
+	h, m := sec/3600, (sec%3600+59)/60
+	if m == 60 {
+		h, m = h+1, 0
+	}
+	if h > 0 {
+		return fmt.Sprintf("%dh%02dm", h, m)
+	}
+	return fmt.Sprintf("%dm", m)
+}
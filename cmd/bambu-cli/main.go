@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -9,14 +10,19 @@ import (
 	"io"
 	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"bambu-cli/internal/config"
+	"bambu-cli/internal/history"
 	"bambu-cli/internal/output"
 	"bambu-cli/internal/printer"
+	"bambu-cli/internal/threemf"
 	"bambu-cli/internal/ui"
 )
 
@@ -42,20 +48,33 @@ type GlobalFlags struct {
 	NoCamera        bool
 	TimeoutSeconds  int
 	ConfigPath      string
+	Replay          string
+	ReplaySpeed     float64
+	// ProfileOnly ignores environment variables naming a single printer
+	// (BAMBU_IP and the like); fleet commands set it for each profile.
+	ProfileOnly bool
+	// AccessCode is an access code already read, e.g. from stdin, that a
+	// command passes on to the commands it runs; no flag sets it.
+	AccessCode string
 }
 
 type ResolvedPrinter struct {
-	IP             string
-	Serial         string
-	AccessCode     string
-	Username       string
-	MQTTPort       int
-	FTPPort        int
-	CameraPort     int
-	Timeout        time.Duration
-	NoCamera       bool
-	ProfileName    string
-	ConfigPathUsed string
+	IP               string
+	Serial           string
+	Model            string
+	BedType          string
+	AccessCode       string
+	Username         string
+	MQTTPort         int
+	FTPPort          int
+	CameraPort       int
+	Timeout          time.Duration
+	ReconnectMax     time.Duration
+	TLS              *tls.Config
+	NoCamera         bool
+	QueueAutoConfirm bool
+	ProfileName      string
+	ConfigPathUsed   string
 }
 
 func main() {
@@ -80,8 +99,18 @@ func run(args []string) int {
 		return 2
 	}
 
+	if dir, err := config.UserDir(); err == nil {
+		if err := printer.LoadCatalogs(dir); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: ignoring catalog override:", err)
+		}
+	}
+
 	cmd := rest[0]
 	subargs := rest[1:]
+	if gf.Replay != "" && !replayable(cmd, subargs) {
+		fmt.Fprintf(os.Stderr, "--replay only works with read-only commands (status, watch, temps get, ams status, hms)\n")
+		return 2
+	}
 
 	switch cmd {
 	case "help":
@@ -104,6 +133,8 @@ func run(args []string) int {
 		return cmdGcode(gf, subargs)
 	case "ams":
 		return cmdAMS(gf, subargs)
+	case "hms":
+		return cmdHMS(gf, subargs)
 	case "calibrate":
 		return cmdCalibrate(gf, subargs)
 	case "home":
@@ -118,6 +149,16 @@ func run(args []string) int {
 		return cmdConfig(gf, subargs)
 	case "doctor":
 		return cmdDoctor(gf, subargs)
+	case "record":
+		return cmdRecord(gf, subargs)
+	case "queue":
+		return cmdQueue(gf, subargs)
+	case "fleet":
+		return cmdFleet(gf, subargs)
+	case "history":
+		return cmdHistory(gf, subargs)
+	case "simulate":
+		return cmdSimulate(gf, subargs)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
 		printUsage()
@@ -154,6 +195,8 @@ func parseGlobalFlags(args []string) (GlobalFlags, []string, error) {
 	fs.BoolVar(&gf.NoCamera, "no-camera", false, "skip camera connection")
 	fs.IntVar(&gf.TimeoutSeconds, "timeout", 0, "network timeout in seconds")
 	fs.StringVar(&gf.ConfigPath, "config", "", "config file path")
+	fs.StringVar(&gf.Replay, "replay", "", "read reports from a recording instead of the printer")
+	fs.Float64Var(&gf.ReplaySpeed, "replay-speed", 1, "replay speed multiplier (0 = instant)")
 
 	if err := fs.Parse(args); err != nil {
 		return gf, nil, err
@@ -164,12 +207,27 @@ func parseGlobalFlags(args []string) (GlobalFlags, []string, error) {
 	return gf, fs.Args(), nil
 }
 
-func resolvePrinter(gf GlobalFlags, needAccess bool, needSerial bool) (ResolvedPrinter, error) {
+// dataPath is a data file such as queue.json next to the user config, or
+// next to --config when one is given.
+func dataPath(gf GlobalFlags, name string) (string, error) {
+	if gf.ConfigPath != "" {
+		return filepath.Join(filepath.Dir(gf.ConfigPath), name), nil
+	}
+	dir, err := config.UserDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// loadMergedConfig reads the user config (or --config) with the project
+// .bambu.json layered on top.
+func loadMergedConfig(gf GlobalFlags) (config.Config, string, error) {
 	cwd, _ := os.Getwd()
 	projectPath := config.ProjectConfigPath(cwd)
 	userPath, err := config.UserConfigPath()
 	if err != nil {
-		return ResolvedPrinter{}, err
+		return config.Config{}, "", err
 	}
 
 	userCfgPath := userPath
@@ -179,13 +237,20 @@ func resolvePrinter(gf GlobalFlags, needAccess bool, needSerial bool) (ResolvedP
 
 	userCfg, err := config.Read(userCfgPath)
 	if err != nil {
-		return ResolvedPrinter{}, err
+		return config.Config{}, "", err
 	}
 	projectCfg, err := config.Read(projectPath)
+	if err != nil {
+		return config.Config{}, "", err
+	}
+	return config.Merge(userCfg, projectCfg), userCfgPath, nil
+}
+
+func resolvePrinter(gf GlobalFlags, needAccess bool, needSerial bool) (ResolvedPrinter, error) {
+	cfg, userCfgPath, err := loadMergedConfig(gf)
 	if err != nil {
 		return ResolvedPrinter{}, err
 	}
-	cfg := config.Merge(userCfg, projectCfg)
 
 	profileName := firstNonEmpty(gf.Printer, os.Getenv("BAMBU_PROFILE"), cfg.DefaultProfile)
 	if profileName == "" && len(cfg.Profiles) == 1 {
@@ -201,41 +266,156 @@ func resolvePrinter(gf GlobalFlags, needAccess bool, needSerial bool) (ResolvedP
 	}
 
 	res := ResolvedPrinter{
-		IP:             firstNonEmpty(gf.IP, os.Getenv("BAMBU_IP"), profile.IP),
-		Serial:         firstNonEmpty(gf.Serial, os.Getenv("BAMBU_SERIAL"), profile.Serial),
-		AccessCode:     "",
-		Username:       firstNonEmpty(profile.Username, "bblp"),
-		MQTTPort:       firstNonZero(envInt("BAMBU_MQTT_PORT"), profile.MQTTPort, 8883),
-		FTPPort:        firstNonZero(envInt("BAMBU_FTP_PORT"), profile.FTPPort, 990),
-		CameraPort:     firstNonZero(envInt("BAMBU_CAMERA_PORT"), profile.CameraPort, 6000),
-		Timeout:        time.Duration(firstNonZero(gf.TimeoutSeconds, envInt("BAMBU_TIMEOUT"), profile.TimeoutSeconds, 10)) * time.Second,
-		NoCamera:       gf.NoCamera || envBool("BAMBU_NO_CAMERA") || profile.NoCamera,
-		ProfileName:    profileName,
-		ConfigPathUsed: userCfgPath,
-	}
-
-	accessFile := firstNonEmpty(gf.AccessCodeFile, os.Getenv("BAMBU_ACCESS_CODE_FILE"), profile.AccessCodeFile)
+		IP:               firstNonEmpty(gf.IP, printerEnv(gf, "BAMBU_IP"), profile.IP),
+		Serial:           firstNonEmpty(gf.Serial, printerEnv(gf, "BAMBU_SERIAL"), profile.Serial),
+		AccessCode:       "",
+		Username:         firstNonEmpty(profile.Username, "bblp"),
+		MQTTPort:         firstNonZero(printerEnvInt(gf, "BAMBU_MQTT_PORT"), profile.MQTTPort, 8883),
+		FTPPort:          firstNonZero(printerEnvInt(gf, "BAMBU_FTP_PORT"), profile.FTPPort, 990),
+		CameraPort:       firstNonZero(printerEnvInt(gf, "BAMBU_CAMERA_PORT"), profile.CameraPort, 6000),
+		Timeout:          time.Duration(firstNonZero(gf.TimeoutSeconds, envInt("BAMBU_TIMEOUT"), profile.TimeoutSeconds, 10)) * time.Second,
+		ReconnectMax:     time.Duration(firstNonZero(envInt("BAMBU_RECONNECT_MAX"), profile.ReconnectMaxSeconds)) * time.Second,
+		NoCamera:         gf.NoCamera || envBool("BAMBU_NO_CAMERA") || profile.NoCamera,
+		QueueAutoConfirm: profile.QueueAutoConfirm,
+		BedType:          profile.BedType,
+		ProfileName:      profileName,
+		ConfigPathUsed:   userCfgPath,
+	}
+
+	accessFile := firstNonEmpty(gf.AccessCodeFile, printerEnv(gf, "BAMBU_ACCESS_CODE_FILE"), profile.AccessCodeFile)
 	if needAccess {
-		code, err := resolveAccessCode(accessFile, gf.AccessCodeStdin)
-		if err != nil {
-			return ResolvedPrinter{}, err
+		res.AccessCode = gf.AccessCode
+		if res.AccessCode == "" {
+			code, err := resolveAccessCode(accessFile, gf.AccessCodeStdin)
+			if err != nil {
+				return ResolvedPrinter{}, err
+			}
+			res.AccessCode = code
 		}
-		res.AccessCode = code
 	}
 
 	if res.IP == "" {
 		return ResolvedPrinter{}, errors.New("missing printer IP; use --ip or config")
 	}
 	if needSerial && res.Serial == "" {
-		return ResolvedPrinter{}, errors.New("missing printer serial; use --serial or config")
+		// The printer's certificate is issued for its serial.
+		chain, err := printer.ProbeCertificate(net.JoinHostPort(res.IP, strconv.Itoa(res.MQTTPort)), res.Timeout)
+		if err != nil {
+			return ResolvedPrinter{}, fmt.Errorf("missing printer serial and could not detect it (%v); use --serial or config", err)
+		}
+		res.Serial = printer.SerialFromCertificate(chain[0])
+		if gf.Verbose {
+			fmt.Fprintf(os.Stderr, "Detected serial %s from printer certificate\n", res.Serial)
+		}
 	}
+	res.Model = firstNonEmpty(profile.Model, printer.ModelFromSerial(res.Serial))
 	if needAccess && res.AccessCode == "" {
 		return ResolvedPrinter{}, errors.New("missing access code; use --access-code-file or --access-code-stdin")
 	}
 
+	trust := printer.Trust{Fingerprint: profile.CertFingerprint, Serial: res.Serial}
+	if profile.CAFile != "" {
+		pool, err := printer.LoadCertPool(profile.CAFile)
+		if err != nil {
+			return ResolvedPrinter{}, err
+		}
+		trust.Roots = pool
+	}
+	if needAccess && trust.Fingerprint == "" && trust.Roots == nil {
+		trust.Fingerprint = pinOnFirstUse(gf, userCfgPath, profileName, res)
+	}
+	res.TLS = trust.TLSConfig()
+
 	return res, nil
 }
 
+// pinOnFirstUse records the certificate a profile's printer presents the
+// first time it is used, so later connections can detect an impostor. The
+// pin is saved in the config file that defines the profile. It returns the
+// pinned fingerprint, or "" when the profile can't be pinned (a warning says
+// so) or the printer could not be reached (the command itself will then
+// report the connection error).
+func pinOnFirstUse(gf GlobalFlags, userCfgPath, profileName string, res ResolvedPrinter) string {
+	cfgPath, _, err := profileConfig(userCfgPath, profileName)
+	if err == nil && (profileName == "" || cfgPath == "") {
+		err = errors.New("no saved profile to pin its certificate in")
+	}
+	if err != nil {
+		name := res.IP
+		if profileName != "" {
+			name = strconv.Quote(profileName)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: printer %s is not verified: %v\n", name, err)
+		return ""
+	}
+	chain, err := printer.ProbeCertificate(net.JoinHostPort(res.IP, strconv.Itoa(res.MQTTPort)), res.Timeout)
+	if err != nil {
+		return ""
+	}
+	fingerprint := printer.CertFingerprint(chain[0])
+	if err := savePin(cfgPath, profileName, fingerprint); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not save certificate pin to %s: %v\n", cfgPath, err)
+		return fingerprint
+	}
+	if !gf.Quiet {
+		fmt.Fprintf(os.Stderr, "Pinned certificate for printer %q in %s (sha256 %s)\n", profileName, cfgPath, fingerprint)
+	}
+	return fingerprint
+}
+
+// configMu serialises config rewrites: fleet commands resolve printers
+// concurrently, and each may pin a certificate.
+var configMu sync.Mutex
+
+// savePin stores a profile's certificate fingerprint. The config is read
+// again under configMu so pins saved meanwhile by other workers are kept.
+func savePin(path, profileName, fingerprint string) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	cfg, err := config.Read(path)
+	if err != nil {
+		return err
+	}
+	p, ok := cfg.Profiles[profileName]
+	if !ok {
+		return fmt.Errorf("profile %q is no longer defined", profileName)
+	}
+	p.CertFingerprint = fingerprint
+	cfg.Profiles[profileName] = p
+	return config.Save(path, cfg)
+}
+
+// profileConfig returns the config file that defines profileName, and its
+// contents: the user config (or --config), or else the project .bambu.json.
+// The path is "" when neither defines it.
+func profileConfig(userCfgPath, profileName string) (string, config.Config, error) {
+	cwd, _ := os.Getwd()
+	for _, path := range []string{userCfgPath, config.ProjectConfigPath(cwd)} {
+		cfg, err := config.Read(path)
+		if err != nil {
+			return "", config.Config{}, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if _, ok := cfg.Profiles[profileName]; ok {
+			return path, cfg, nil
+		}
+	}
+	return "", config.Config{}, nil
+}
+
+func dialMQTT(res ResolvedPrinter) (*printer.MQTTClient, error) {
+	return printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, mqttOptions(res))
+}
+
+func mqttOptions(res ResolvedPrinter) printer.MQTTOptions {
+	return printer.MQTTOptions{
+		Username:     res.Username,
+		Port:         res.MQTTPort,
+		Timeout:      res.Timeout,
+		ReconnectMax: res.ReconnectMax,
+		TLS:          res.TLS,
+	}
+}
+
 func resolveAccessCode(path string, fromStdin bool) (string, error) {
 	if fromStdin {
 		data, err := io.ReadAll(os.Stdin)
@@ -262,6 +442,50 @@ func resolveAccessCode(path string, fromStdin bool) (string, error) {
 	return code, nil
 }
 
+// openReportClient returns a client whose reports are ready to read: the
+// --replay recording when one is given, otherwise a live connection that has
+// been sent pushall. Replays run at speed; 0 applies the whole recording
+// before returning, so one-shot commands show its final state.
+func openReportClient(gf GlobalFlags, speed float64) (*printer.MQTTClient, error) {
+	if gf.Replay != "" {
+		client, err := printer.NewReplayClient(gf.Replay, speed)
+		if err != nil {
+			return nil, err
+		}
+		_ = client.WaitForData(10 * time.Second)
+		return client, nil
+	}
+	res, err := resolvePrinter(gf, true, true)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialMQTT(res)
+	if err != nil {
+		return nil, err
+	}
+	_ = client.PushAll()
+	var mismatch *printer.SerialMismatchError
+	if err := client.WaitForData(res.Timeout); errors.As(err, &mismatch) {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// replayable reports whether a command only reads printer reports and can
+// therefore run against a recording.
+func replayable(cmd string, args []string) bool {
+	switch cmd {
+	case "status", "watch", "hms", "help":
+		return true
+	case "temps":
+		return len(args) > 0 && args[0] == "get"
+	case "ams":
+		return len(args) > 0 && args[0] == "status"
+	}
+	return false
+}
+
 func cmdHelp(_ GlobalFlags, args []string) int {
 	if len(args) == 0 {
 		printUsage()
@@ -272,113 +496,302 @@ func cmdHelp(_ GlobalFlags, args []string) int {
 }
 
 func cmdStatus(gf GlobalFlags, _ []string) int {
-	res, err := resolvePrinter(gf, true, true)
-	if err != nil {
-		return errExit(err)
-	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := openReportClient(gf, 0)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
 
-	_ = client.PushAll()
-	_ = client.WaitForData(res.Timeout)
-
 	status := printer.GetStatus(client)
+	return exitOnErr(writeStatus(gf, status, nil))
+}
 
-	format := selectFormat(gf)
-	switch format {
+// writeStatus renders a status in the selected output format. Extra plain
+// keys (such as a watch timestamp) are merged into the plain output.
+func writeStatus(gf GlobalFlags, status printer.Status, extra map[string]string) error {
+	switch selectFormat(gf) {
 	case output.JSON:
-		if err := output.WriteJSON(os.Stdout, status); err != nil {
-			return errExit(err)
-		}
+		return output.WriteJSON(os.Stdout, status)
 	case output.Plain:
-		kv := map[string]string{
-			"gcode_state":       string(status.GcodeState),
-			"print_status":      status.PrintStatus,
-			"percent":           strconv.Itoa(status.Percent),
-			"layer_current":     strconv.Itoa(status.LayerCurrent),
-			"layer_total":       strconv.Itoa(status.LayerTotal),
-			"bed_temp":          fmtFloat(status.BedTemp),
-			"nozzle_temp":       fmtFloat(status.NozzleTemp),
-			"chamber_temp":      fmtFloat(status.ChamberTemp),
-			"file":              status.File,
-			"light":             status.Light,
-			"wifi_signal":       status.WifiSignal,
-			"error_code":        strconv.Itoa(status.ErrorCode),
-			"remaining_minutes": formatRemaining(status.RemainingMinutes),
-		}
-		if err := output.WritePlainKV(os.Stdout, kv); err != nil {
-			return errExit(err)
+		kv := statusKV(status)
+		for k, v := range extra {
+			kv[k] = v
 		}
+		return output.WritePlainKV(os.Stdout, kv)
 	default:
 		printStatusHuman(status)
+		return nil
 	}
+}
 
-	return 0
+func statusKV(status printer.Status) map[string]string {
+	kv := map[string]string{
+		"gcode_state":       string(status.GcodeState),
+		"print_status":      status.PrintStatus,
+		"percent":           strconv.Itoa(status.Percent),
+		"layer_current":     strconv.Itoa(status.LayerCurrent),
+		"layer_total":       strconv.Itoa(status.LayerTotal),
+		"bed_temp":          fmtFloat(status.BedTemp),
+		"nozzle_temp":       fmtFloat(status.NozzleTemp),
+		"chamber_temp":      fmtFloat(status.ChamberTemp),
+		"file":              status.File,
+		"light":             status.Light,
+		"wifi_signal":       status.WifiSignal,
+		"error_code":        strconv.Itoa(status.ErrorCode),
+		"remaining_minutes": formatRemaining(status.RemainingMinutes),
+		"speed_level":       status.SpeedLevel,
+		"speed_magnitude":   strconv.Itoa(status.SpeedMagnitude),
+		"hms":               hmsCodes(status.HMS),
+		"skipped_objects":   joinInts(status.SkippedObjects),
+	}
+	if status.Error != nil {
+		kv["error"] = status.Error.Hex
+		kv["error_description"] = status.Error.Description
+		kv["error_action"] = status.Error.Action
+	}
+	return kv
+}
+
+func hmsCodes(alerts []printer.HMSAlert) string {
+	codes := make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		codes = append(codes, a.Code)
+	}
+	return strings.Join(codes, ",")
+}
+
+func cmdHMS(gf GlobalFlags, _ []string) int {
+	client, err := openReportClient(gf, 0)
+	if err != nil {
+		return errExit(err)
+	}
+	defer client.Close()
+
+	alerts := printer.DecodeHMS(client.Report().HMS)
+	switch selectFormat(gf) {
+	case output.JSON:
+		return exitOnErr(output.WriteJSON(os.Stdout, map[string]any{"hms": alerts}))
+	case output.Plain:
+		for _, a := range alerts {
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\n", a.Code, a.Severity, a.Module, a.Message)
+		}
+		return 0
+	default:
+		if len(alerts) == 0 {
+			fmt.Fprintln(os.Stdout, "No HMS alerts")
+			return 0
+		}
+		for _, a := range alerts {
+			fmt.Fprintln(os.Stdout, formatHMSAlert(a))
+		}
+		return 0
+	}
+}
+
+func formatHMSAlert(a printer.HMSAlert) string {
+	return fmt.Sprintf("[%s] %s: %s (%s)", a.Severity, a.Module, a.Message, a.Code)
 }
 
 func cmdWatch(gf GlobalFlags, args []string) int {
 	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
-	interval := fs.Int("interval", 5, "seconds between updates")
+	interval := fs.Int("interval", 5, "max seconds between updates")
 	refresh := fs.Bool("refresh", false, "send pushall each interval")
+	var until stringList
+	fs.Var(&until, "until", "stop when condition matches (repeatable)")
+	timeoutFlag := fs.String("timeout", "", "give up after duration (e.g. 90m or seconds)")
 	if err := fs.Parse(args); err != nil {
 		return errExit(err)
 	}
-
-	res, err := resolvePrinter(gf, true, true)
+	var conds []printer.Condition
+	for _, expr := range until {
+		cond, err := printer.ParseCondition(expr)
+		if err != nil {
+			return errExit(err)
+		}
+		conds = append(conds, cond)
+	}
+	timeout, err := parseDuration(*timeoutFlag)
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+
+	client, err := openReportClient(gf, gf.ReplaySpeed)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
 
-	_ = client.PushAll()
-	_ = client.WaitForData(res.Timeout)
+	events, unsubscribe := client.Subscribe(64)
+	defer unsubscribe()
 
 	ticker := time.NewTicker(time.Duration(*interval) * time.Second)
 	defer ticker.Stop()
 
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	// Jobs seen running are recorded in the history; a replay is not a job.
+	var rec *jobRecorder
+	if gf.Replay == "" {
+		if res, err := resolvePrinter(gf, false, false); err == nil {
+			rec = newJobRecorder(gf, res)
+		}
+	}
+	replayDone := client.ReplayDone()
+	lastConn := printer.ConnConnected
 	for {
+		ended := false
+		select {
+		case <-replayDone:
+			ended = true
+		default:
+		}
+		if gf.Replay == "" {
+			conn := client.Connection()
+			if conn.State != lastConn {
+				if err := writeConnection(gf, conn); err != nil {
+					return errExit(err)
+				}
+				lastConn = conn.State
+			}
+			if conn.State != printer.ConnConnected {
+				// The cached report is stale; wait for the link to return
+				// rather than repeating it.
+				select {
+				case <-events:
+					drainEvents(events)
+				case <-ticker.C:
+				case <-deadline:
+					if len(conds) == 0 {
+						return 0
+					}
+					fmt.Fprintf(os.Stderr, "Error: timeout after %s waiting for %s\n", timeout, joinConditions(conds))
+					return exitTimeout
+				}
+				continue
+			}
+		}
 		status := printer.GetStatus(client)
-		format := selectFormat(gf)
-		switch format {
-		case output.JSON:
-			if err := output.WriteJSON(os.Stdout, status); err != nil {
-				return errExit(err)
+		if rec != nil {
+			rec.observe(status)
+		}
+		if err := writeStatus(gf, status, map[string]string{"timestamp": time.Now().Format(time.RFC3339)}); err != nil {
+			return errExit(err)
+		}
+		if len(conds) > 0 {
+			if code, done := untilResult(conds, status); done {
+				return code
 			}
-		case output.Plain:
-			kv := map[string]string{
-				"timestamp":         time.Now().Format(time.RFC3339),
-				"gcode_state":       string(status.GcodeState),
-				"print_status":      status.PrintStatus,
-				"percent":           strconv.Itoa(status.Percent),
-				"layer_current":     strconv.Itoa(status.LayerCurrent),
-				"layer_total":       strconv.Itoa(status.LayerTotal),
-				"bed_temp":          fmtFloat(status.BedTemp),
-				"nozzle_temp":       fmtFloat(status.NozzleTemp),
-				"chamber_temp":      fmtFloat(status.ChamberTemp),
-				"file":              status.File,
-				"light":             status.Light,
-				"wifi_signal":       status.WifiSignal,
-				"error_code":        strconv.Itoa(status.ErrorCode),
-				"remaining_minutes": formatRemaining(status.RemainingMinutes),
+		}
+		if ended {
+			if len(conds) == 0 {
+				return 0
 			}
-			if err := output.WritePlainKV(os.Stdout, kv); err != nil {
-				return errExit(err)
+			fmt.Fprintf(os.Stderr, "Error: recording ended before %s\n", joinConditions(conds))
+			return exitTimeout
+		}
+
+		select {
+		case <-events:
+			drainEvents(events)
+		case <-ticker.C:
+			if *refresh {
+				_ = client.PushAll()
 			}
-		default:
-			printStatusHuman(status)
+		case <-replayDone:
+			// Render the final state once more and stop.
+		case <-deadline:
+			if len(conds) == 0 {
+				return 0
+			}
+			fmt.Fprintf(os.Stderr, "Error: timeout after %s waiting for %s\n", timeout, joinConditions(conds))
+			return exitTimeout
 		}
+	}
+}
 
-		<-ticker.C
-		if *refresh {
-			_ = client.PushAll()
+// writeConnection reports a change in the watch connection. JSON output gets
+// a connected or disconnected event object in the status stream.
+func writeConnection(gf GlobalFlags, conn printer.Connection) error {
+	event := "disconnected"
+	if conn.State == printer.ConnConnected {
+		event = "connected"
+	}
+	switch selectFormat(gf) {
+	case output.JSON:
+		return output.WriteJSON(os.Stdout, map[string]any{"event": event, "connection": conn})
+	case output.Plain:
+		kv := map[string]string{
+			"event":      event,
+			"connection": string(conn.State),
+			"timestamp":  conn.Since.Format(time.RFC3339),
+		}
+		if conn.State != printer.ConnConnected && !conn.LastMessage.IsZero() {
+			kv["stale_since"] = conn.LastMessage.Format(time.RFC3339)
+		}
+		return output.WritePlainKV(os.Stdout, kv)
+	default:
+		if conn.State == printer.ConnConnected {
+			fmt.Fprintln(os.Stdout, "Connection restored")
+			return nil
+		}
+		line := fmt.Sprintf("Connection lost (%s)", conn.State)
+		if !conn.LastMessage.IsZero() {
+			line += ", stale since " + conn.LastMessage.Format("15:04")
+		}
+		if conn.Error != "" {
+			line += ": " + conn.Error
+		}
+		fmt.Fprintln(os.Stdout, line)
+		return nil
+	}
+}
+
+// untilResult decides whether watch --until is finished: 0 when a condition
+// matches, exitPrintFailed when the print failed and exitPrinterError when
+// the printer raises a fatal HMS error. Failures are checked first, so a
+// condition naming FAILED still exits non-zero. Error codes alone don't end
+// the watch: they linger after a cancel and accompany recoverable pauses.
+func untilResult(conds []printer.Condition, status printer.Status) (int, bool) {
+	if status.GcodeState == printer.GcodeStateFailed {
+		fmt.Fprintf(os.Stderr, "Error: print failed before %s\n", joinConditions(conds))
+		return exitPrintFailed, true
+	}
+	for _, alert := range status.HMS {
+		if alert.Severity == "fatal" {
+			fmt.Fprintf(os.Stderr, "Error: printer reported %s (%s) before %s\n", alert.Code, alert.Message, joinConditions(conds))
+			return exitPrinterError, true
+		}
+	}
+	for _, c := range conds {
+		if c.Match(status) {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+func joinConditions(conds []printer.Condition) string {
+	parts := make([]string, 0, len(conds))
+	for _, c := range conds {
+		parts = append(parts, c.String())
+	}
+	return strings.Join(parts, " or ")
+}
+
+// drainEvents discards queued events so a burst of changes from one report
+// renders once.
+func drainEvents(events <-chan printer.Event) {
+	for {
+		select {
+		case <-events:
+		default:
+			return
 		}
 	}
 }
@@ -403,7 +816,7 @@ func cmdLight(gf GlobalFlags, args []string) int {
 		return 0
 	}
 
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
@@ -411,9 +824,9 @@ func cmdLight(gf GlobalFlags, args []string) int {
 
 	switch action {
 	case "on":
-		return exitOnErr(client.Publish(printer.PayloadLight(true)))
+		return exitOnReply(client.Request(printer.PayloadLight(true), res.Timeout))
 	case "off":
-		return exitOnErr(client.Publish(printer.PayloadLight(false)))
+		return exitOnReply(client.Request(printer.PayloadLight(false), res.Timeout))
 	default:
 		printCommandUsage("light")
 		return 2
@@ -440,17 +853,11 @@ func cmdTemps(gf GlobalFlags, args []string) int {
 }
 
 func cmdTempsGet(gf GlobalFlags, _ []string) int {
-	res, err := resolvePrinter(gf, true, true)
-	if err != nil {
-		return errExit(err)
-	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := openReportClient(gf, 0)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
-	_ = client.PushAll()
-	_ = client.WaitForData(res.Timeout)
 
 	status := printer.GetStatus(client)
 	format := selectFormat(gf)
@@ -494,7 +901,7 @@ func cmdTempsSet(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
@@ -511,7 +918,7 @@ func cmdTempsSet(gf GlobalFlags, args []string) int {
 		lines = append(lines, fmt.Sprintf("M141 S%d", *chamber))
 	}
 	payload := printer.PayloadGcode(strings.Join(lines, "\n"))
-	return exitOnErr(client.Publish(payload))
+	return exitOnReply(client.Request(payload, res.Timeout))
 }
 
 func cmdPrint(gf GlobalFlags, args []string) int {
@@ -531,28 +938,68 @@ func cmdPrint(gf GlobalFlags, args []string) int {
 		return cmdPrintResume(gf, subargs)
 	case "stop":
 		return cmdPrintStop(gf, subargs)
+	case "inspect":
+		return cmdPrintInspect(gf, subargs)
+	case "skip":
+		return cmdPrintSkip(gf, subargs)
+	case "speed":
+		return cmdPrintSpeed(gf, subargs)
 	default:
 		printCommandUsage("print")
 		return 2
 	}
 }
 
+// printStartFlags are the options of print start, shared with queue add so
+// queued jobs are validated the same way.
+type printStartFlags struct {
+	plate           *string
+	noUpload        *bool
+	noAMS           *bool
+	amsMapping      *string
+	skipObjects     *string
+	flowCalibration *bool
+	bedType         *string
+	timelapse       *bool
+	bedLeveling     *bool
+	vibrationCali   *bool
+	layerInspect    *bool
+	md5sum          *string
+	remoteName      *string
+	follow          *bool
+}
+
+func addPrintStartFlags(fs *flag.FlagSet) printStartFlags {
+	return printStartFlags{
+		plate:           fs.String("plate", "1", "plate number or gcode path"),
+		noUpload:        fs.Bool("no-upload", false, "do not upload file"),
+		noAMS:           fs.Bool("no-ams", false, "disable AMS"),
+		amsMapping:      fs.String("ams-mapping", "", "comma-separated AMS mapping (default: match 3MF filaments to loaded trays)"),
+		skipObjects:     fs.String("skip-objects", "", "comma-separated object IDs"),
+		flowCalibration: fs.Bool("flow-calibration", true, "enable flow calibration"),
+		bedType:         fs.String("bed-type", "", "plate the job was sliced for (default: from the 3MF)"),
+		timelapse:       fs.Bool("timelapse", false, "record a timelapse"),
+		bedLeveling:     fs.Bool("bed-leveling", true, "run bed leveling before printing"),
+		vibrationCali:   fs.Bool("vibration-cali", true, "run vibration calibration before printing"),
+		layerInspect:    fs.Bool("layer-inspect", false, "inspect the first layer (default: from the 3MF)"),
+		md5sum:          fs.String("md5", "", "MD5 of the plate gcode (default: from the 3MF)"),
+		remoteName:      fs.String("remote-name", "", "remote filename"),
+		follow:          fs.Bool("follow", false, "show progress until the print ends"),
+	}
+}
+
 func cmdPrintStart(gf GlobalFlags, args []string) int {
 	fs := flag.NewFlagSet("print start", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
-	plate := fs.String("plate", "1", "plate number or gcode path")
-	noUpload := fs.Bool("no-upload", false, "do not upload file")
-	noAMS := fs.Bool("no-ams", false, "disable AMS")
-	amsMapping := fs.String("ams-mapping", "0", "comma-separated AMS mapping")
-	skipObjects := fs.String("skip-objects", "", "comma-separated object IDs")
-	flowCalibration := fs.Bool("flow-calibration", true, "enable flow calibration")
-	remoteName := fs.String("remote-name", "", "remote filename")
+	o := addPrintStartFlags(fs)
 	if err := fs.Parse(args); err != nil {
 		return errExit(err)
 	}
 	if fs.NArg() < 1 {
 		return errExit(errors.New("print start requires a file path"))
 	}
+	explicitFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicitFlags[f.Name] = true })
 
 	inputPath := fs.Arg(0)
 	if gf.DryRun {
@@ -565,72 +1012,188 @@ func cmdPrintStart(gf GlobalFlags, args []string) int {
 		return errExit(err)
 	}
 
-	plateLocation := plateToLocation(*plate)
-	useAMS := !*noAMS
-	mapping, err := parseIntList(*amsMapping)
-	if err != nil {
-		return errExit(err)
-	}
+	plateLocation := plateToLocation(*o.plate)
+	useAMS := !*o.noAMS
+	is3MF := strings.HasSuffix(strings.ToLower(inputPath), ".3mf")
 	var skipList []int
-	if *skipObjects != "" {
-		skipList, err = parseIntList(*skipObjects)
+	if *o.skipObjects != "" {
+		skipList, err = parseIntList(*o.skipObjects)
 		if err != nil {
 			return errExit(err)
 		}
 	}
 
-	remote := *remoteName
+	remote := *o.remoteName
 	if remote == "" {
-		if *noUpload {
+		if *o.noUpload {
 			remote = inputPath
 		} else {
 			remote = defaultRemoteName(inputPath)
 		}
 	}
+	if *o.noUpload && strings.HasSuffix(strings.ToLower(inputPath), ".gcode") {
+		return errExit(errors.New("--no-upload cannot be used with .gcode input"))
+	}
+
+	// Connect first so the job is checked against the printer before
+	// anything is uploaded.
+	client, err := dialMQTT(res)
+	if err != nil {
+		return errExit(err)
+	}
+	defer client.Close()
+	_ = client.PushAll()
+	_ = client.WaitForData(res.Timeout)
 
-	if *noUpload {
-		if strings.HasSuffix(strings.ToLower(inputPath), ".gcode") {
-			return errExit(errors.New("--no-upload cannot be used with .gcode input"))
+	var explicit []int
+	if *o.amsMapping != "" {
+		explicit, err = parseIntList(*o.amsMapping)
+		if err != nil {
+			return errExit(err)
 		}
-	} else {
-		ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout)
-		if strings.HasSuffix(strings.ToLower(inputPath), ".3mf") {
-			if err := ftpClient.Upload(inputPath, remote); err != nil {
+	}
+	report := client.Report()
+	job := preflightJob{}
+	if is3MF {
+		proj, err := loadJobProject(res, inputPath, *o.noUpload)
+		if err != nil {
+			return errExit(err)
+		}
+		pl, ok := proj.Plate(plateNumber(plateLocation))
+		if !ok {
+			return errExit(fmt.Errorf("%s has no plate %s", inputPath, *o.plate))
+		}
+		job.Model, job.Plate = proj.PrinterModel, pl
+		if !explicitFlags["bed-type"] {
+			*o.bedType = pl.BedType
+		}
+		if !explicitFlags["md5"] {
+			*o.md5sum = pl.GcodeMD5
+		}
+		if !explicitFlags["layer-inspect"] && proj.Settings != nil {
+			*o.layerInspect = proj.Settings.String("scan_first_layer") == "1"
+		}
+		if useAMS {
+			if job.Mapping, err = jobMapping(gf, report, pl, explicit); err != nil {
 				return errExit(err)
 			}
-		} else {
+		}
+	}
+	mapping := explicit
+	switch {
+	case job.Mapping != nil:
+		mapping = job.Mapping.Mapping
+	case mapping == nil:
+		mapping = []int{0}
+	}
+
+	checks := preflightChecks(res, report, job)
+	failed := preflightFailed(checks)
+	if failed || !gf.Quiet {
+		writePreflight(os.Stderr, checks)
+	}
+	if failed {
+		if !gf.Force {
+			return errExit(errors.New("pre-flight checks failed; pass --force to start anyway"))
+		}
+		fmt.Fprintln(os.Stderr, "Warning: starting despite failed pre-flight checks (--force)")
+	}
+	if explicit == nil && job.Mapping != nil && askMapping(gf) {
+		if err := confirmMapping(gf); err != nil {
+			return errExit(err)
+		}
+	}
+
+	if !*o.noUpload {
+		ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout, res.TLS)
+		localPath := inputPath
+		if !is3MF {
 			tmpPath, cleanup, err := printer.Create3MFTempFromFile(inputPath, plateLocation)
 			if err != nil {
 				return errExit(err)
 			}
 			defer cleanup()
-			if err := ftpClient.Upload(tmpPath, remote); err != nil {
-				return errExit(err)
-			}
+			localPath = tmpPath
+		}
+		done := showTransferProgress(gf, ftpClient, "upload", remote)
+		err := ftpClient.Upload(localPath, remote)
+		done()
+		if err != nil {
+			return errExit(err)
 		}
 	}
 
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	payload := printer.PayloadStartPrint(printer.StartPrintOptions{
+		Filename:             remote,
+		PlateLocation:        plateLocation,
+		UseAMS:               useAMS,
+		AMSMapping:           mapping,
+		SkipObjects:          skipList,
+		BedType:              threemf.BedTypeID(*o.bedType),
+		BedLeveling:          *o.bedLeveling,
+		FlowCalibration:      *o.flowCalibration,
+		VibrationCalibration: *o.vibrationCali,
+		LayerInspect:         *o.layerInspect,
+		Timelapse:            *o.timelapse,
+		MD5:                  strings.ToUpper(strings.TrimSpace(*o.md5sum)),
+	})
+	if _, err := client.Request(payload, res.Timeout); err != nil {
+		return errExit(err)
+	}
+	rec := newJobRecorder(gf, res)
+	started := history.Record{File: remote, Plate: plateNumber(plateLocation)}
+	if job.Plate != nil {
+		started.Filament = jobFilament(job.Plate)
+	}
+	rec.started(started)
+	if *o.follow {
+		return followPrint(gf, client, rec)
+	}
+	return 0
+}
+
+func cmdPrintPause(gf GlobalFlags, _ []string) int {
+	res, err := resolvePrinter(gf, true, true)
+	if err != nil {
+		return errExit(err)
+	}
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
-
-	payload := printer.PayloadStartPrint(remote, plateLocation, useAMS, mapping, skipList, *flowCalibration)
-	return exitOnErr(client.Publish(payload))
+	return exitOnReply(client.Request(printer.PayloadPrintPause(), res.Timeout))
 }
 
-func cmdPrintPause(gf GlobalFlags, _ []string) int {
+func cmdPrintSpeed(gf GlobalFlags, args []string) int {
+	if len(args) != 1 {
+		return errExit(errors.New("print speed requires silent, standard, sport or ludicrous"))
+	}
+	level, err := printer.ParseSpeedLevel(args[0])
+	if err != nil {
+		return errExit(err)
+	}
+	if gf.DryRun {
+		fmt.Fprintf(os.Stdout, "Would set print speed to %s\n", level)
+		return 0
+	}
+
 	res, err := resolvePrinter(gf, true, true)
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
-	return exitOnErr(client.Publish(printer.PayloadPrintPause()))
+	_ = client.PushAll()
+	_ = client.WaitForData(res.Timeout)
+	state := printer.ParseGcodeState(client.Report().GcodeState)
+	if state != printer.GcodeStateRunning && state != printer.GcodeStatePause {
+		return errExit(fmt.Errorf("print speed can only be changed while printing (printer is %s)", state))
+	}
+	return exitOnReply(client.Request(printer.PayloadPrintSpeed(level), res.Timeout))
 }
 
 func cmdPrintResume(gf GlobalFlags, _ []string) int {
@@ -638,12 +1201,12 @@ func cmdPrintResume(gf GlobalFlags, _ []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
-	return exitOnErr(client.Publish(printer.PayloadPrintResume()))
+	return exitOnReply(client.Request(printer.PayloadPrintResume(), res.Timeout))
 }
 
 func cmdPrintStop(gf GlobalFlags, _ []string) int {
@@ -666,12 +1229,16 @@ func cmdPrintStop(gf GlobalFlags, _ []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
-	return exitOnErr(client.Publish(printer.PayloadPrintStop()))
+	if _, err := client.Request(printer.PayloadPrintStop(), res.Timeout); err != nil {
+		return errExit(err)
+	}
+	newJobRecorder(gf, res).stopped()
+	return 0
 }
 
 func cmdFiles(gf GlobalFlags, args []string) int {
@@ -701,37 +1268,116 @@ func cmdFilesList(gf GlobalFlags, args []string) int {
 	fs := flag.NewFlagSet("files list", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	dir := fs.String("dir", "", "directory to list")
+	long := fs.Bool("long", false, "show type, size and modification time")
+	fs.BoolVar(long, "l", false, "alias for --long")
+	recursive := fs.Bool("recursive", false, "list subdirectories too")
+	fs.BoolVar(recursive, "R", false, "alias for --recursive")
+	sortBy := fs.String("sort", "name", "sort by name, size (largest first) or time (newest first)")
 	if err := fs.Parse(args); err != nil {
 		return errExit(err)
 	}
+	if err := sortRemoteFiles(nil, *sortBy); err != nil {
+		return errExit(err)
+	}
 
 	res, err := resolvePrinter(gf, true, false)
 	if err != nil {
 		return errExit(err)
 	}
-	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout)
-	entries, err := ftpClient.List(*dir)
+	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout, res.TLS)
+	var entries []printer.RemoteFile
+	if *recursive {
+		entries, err = ftpClient.ListRecursive(*dir)
+	} else {
+		entries, err = ftpClient.List(*dir)
+	}
 	if err != nil {
 		return errExit(err)
 	}
+	_ = sortRemoteFiles(entries, *sortBy)
 
+	// A recursive listing shows paths so entries of different directories
+	// can be told apart.
+	name := func(e printer.RemoteFile) string {
+		if *recursive {
+			return e.Path
+		}
+		return e.Name
+	}
 	format := selectFormat(gf)
 	switch format {
 	case output.JSON:
+		if entries == nil {
+			entries = []printer.RemoteFile{}
+		}
 		return exitOnErr(output.WriteJSON(os.Stdout, map[string]any{"entries": entries}))
 	case output.Plain:
 		for _, e := range entries {
-			fmt.Fprintln(os.Stdout, e)
+			if *long {
+				fmt.Fprintf(os.Stdout, "%s\t%d\t%s\t%s\n", e.Type, e.Size, e.ModTime.Format(time.RFC3339), name(e))
+			} else {
+				fmt.Fprintln(os.Stdout, name(e))
+			}
 		}
 		return 0
 	default:
+		if !*long {
+			for _, e := range entries {
+				fmt.Fprintln(os.Stdout, name(e))
+			}
+			return 0
+		}
 		for _, e := range entries {
-			fmt.Fprintln(os.Stdout, e)
+			size := "-"
+			if e.Type != printer.FileTypeDir {
+				size = humanSize(e.Size)
+			}
+			modified := "-"
+			if !e.ModTime.IsZero() {
+				modified = e.ModTime.Local().Format("2006-01-02 15:04")
+			}
+			n := name(e)
+			if e.Type == printer.FileTypeDir {
+				n += "/"
+			}
+			fmt.Fprintf(os.Stdout, "%10s  %-16s  %s\n", size, modified, n)
 		}
 		return 0
 	}
 }
 
+// sortRemoteFiles orders a listing in place. Sorting by name uses the path so
+// a recursive listing keeps each directory's entries together.
+func sortRemoteFiles(entries []printer.RemoteFile, by string) error {
+	var less func(a, b printer.RemoteFile) bool
+	switch by {
+	case "name":
+		less = func(a, b printer.RemoteFile) bool { return a.Path < b.Path }
+	case "size":
+		less = func(a, b printer.RemoteFile) bool { return a.Size > b.Size }
+	case "time":
+		less = func(a, b printer.RemoteFile) bool { return a.ModTime.After(b.ModTime) }
+	default:
+		return fmt.Errorf("unknown sort %q (want name, size or time)", by)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+	return nil
+}
+
+// humanSize renders a byte count with a binary unit, e.g. "1.4 MiB".
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func cmdFilesUpload(gf GlobalFlags, args []string) int {
 	fs := flag.NewFlagSet("files upload", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
@@ -753,12 +1399,15 @@ func cmdFilesUpload(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout)
+	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout, res.TLS)
 	remotePath := *remote
 	if remotePath == "" {
 		remotePath = filepath.Base(localPath)
 	}
-	return exitOnErr(ftpClient.Upload(localPath, remotePath))
+	done := showTransferProgress(gf, ftpClient, "upload", remotePath)
+	err = ftpClient.Upload(localPath, remotePath)
+	done()
+	return exitOnErr(err)
 }
 
 func cmdFilesDownload(gf GlobalFlags, args []string) int {
@@ -777,28 +1426,23 @@ func cmdFilesDownload(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout)
+	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout, res.TLS)
 
-	var w io.Writer
-	var file *os.File
 	if *outPath == "" {
 		return errExit(errors.New("--out is required"))
 	}
+	if *outPath == "-" && ui.IsTerminal(os.Stdout) && !gf.Force {
+		return errExit(errors.New("refusing to write binary data to terminal; use --force or --out <file>"))
+	}
+
+	done := showTransferProgress(gf, ftpClient, "download", remotePath)
 	if *outPath == "-" {
-		if ui.IsTerminal(os.Stdout) && !gf.Force {
-			return errExit(errors.New("refusing to write binary data to terminal; use --force or --out <file>"))
-		}
-		w = os.Stdout
+		err = ftpClient.Download(remotePath, os.Stdout)
 	} else {
-		file, err = os.Create(*outPath)
-		if err != nil {
-			return errExit(err)
-		}
-		defer file.Close()
-		w = file
+		err = ftpClient.DownloadFile(remotePath, *outPath)
 	}
-
-	return exitOnErr(ftpClient.Download(remotePath, w))
+	done()
+	return exitOnErr(err)
 }
 
 func cmdFilesDelete(gf GlobalFlags, args []string) int {
@@ -831,7 +1475,7 @@ func cmdFilesDelete(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout)
+	ftpClient := printer.NewFTPClient(res.IP, res.AccessCode, res.Username, res.FTPPort, res.Timeout, res.TLS)
 	return exitOnErr(ftpClient.Delete(remotePath))
 }
 
@@ -856,7 +1500,7 @@ func cmdCamera(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	cam := printer.NewCameraClient(res.IP, res.AccessCode, res.Username, res.CameraPort, res.Timeout)
+	cam := printer.NewCameraClient(res.IP, res.AccessCode, res.Username, res.CameraPort, res.Timeout, res.TLS)
 	img, err := cam.Snapshot()
 	if err != nil {
 		return errExit(err)
@@ -936,14 +1580,14 @@ func cmdGcode(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
 
 	payload := printer.PayloadGcode(strings.Join(lines, "\n"))
-	return exitOnErr(client.Publish(payload))
+	return exitOnReply(client.Request(payload, res.Timeout))
 }
 
 func cmdAMS(gf GlobalFlags, args []string) int {
@@ -951,20 +1595,13 @@ func cmdAMS(gf GlobalFlags, args []string) int {
 		printCommandUsage("ams")
 		return 2
 	}
-	res, err := resolvePrinter(gf, true, true)
-	if err != nil {
-		return errExit(err)
-	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := openReportClient(gf, 0)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
 
-	_ = client.PushAll()
-	_ = client.WaitForData(res.Timeout)
-
-	amsInfo, _ := client.Get("print", "ams")
+	amsInfo := client.Report().AMS
 	format := selectFormat(gf)
 	switch format {
 	case output.JSON:
@@ -1006,14 +1643,14 @@ func cmdCalibrate(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
 
 	payload := printer.PayloadCalibration(!*noBed, !*noMotor, !*noVibration)
-	return exitOnErr(client.Publish(payload))
+	return exitOnReply(client.Request(payload, res.Timeout))
 }
 
 func cmdHome(gf GlobalFlags, _ []string) int {
@@ -1025,13 +1662,13 @@ func cmdHome(gf GlobalFlags, _ []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
 	payload := printer.PayloadGcode("G28")
-	return exitOnErr(client.Publish(payload))
+	return exitOnReply(client.Request(payload, res.Timeout))
 }
 
 func cmdMove(gf GlobalFlags, args []string) int {
@@ -1057,14 +1694,14 @@ func cmdMove(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
 
 	payload := printer.PayloadGcode(fmt.Sprintf("G90\nG0 Z%d", *height))
-	return exitOnErr(client.Publish(payload))
+	return exitOnReply(client.Request(payload, res.Timeout))
 }
 
 func cmdFans(gf GlobalFlags, args []string) int {
@@ -1116,14 +1753,14 @@ func cmdFans(gf GlobalFlags, args []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
 
 	payload := printer.PayloadGcode(strings.Join(lines, "\n"))
-	return exitOnErr(client.Publish(payload))
+	return exitOnReply(client.Request(payload, res.Timeout))
 }
 
 func cmdReboot(gf GlobalFlags, _ []string) int {
@@ -1145,12 +1782,18 @@ func cmdReboot(gf GlobalFlags, _ []string) int {
 	if err != nil {
 		return errExit(err)
 	}
-	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, res.Username, res.MQTTPort, res.Timeout)
+	client, err := dialMQTT(res)
 	if err != nil {
 		return errExit(err)
 	}
 	defer client.Close()
-	return exitOnErr(client.Publish(printer.PayloadReboot()))
+	_, err = client.Request(printer.PayloadReboot(), res.Timeout)
+	if errors.Is(err, printer.ErrReplyTimeout) {
+		// The printer may go down before it gets to answer.
+		fmt.Fprintln(os.Stderr, "Warning: no reply to reboot; the printer may already be restarting")
+		return 0
+	}
+	return exitOnErr(err)
 }
 
 func cmdConfig(gf GlobalFlags, args []string) int {
@@ -1170,6 +1813,10 @@ func cmdConfig(gf GlobalFlags, args []string) int {
 		return cmdConfigSet(gf, subargs)
 	case "remove":
 		return cmdConfigRemove(gf, subargs)
+	case "trust":
+		return cmdConfigTrust(gf, subargs)
+	case "untrust":
+		return cmdConfigUntrust(gf, subargs)
 	default:
 		printCommandUsage("config")
 		return 2
@@ -1218,14 +1865,19 @@ func cmdConfigSet(gf GlobalFlags, args []string) int {
 	fs.SetOutput(io.Discard)
 	profile := fs.String("printer", "", "profile name")
 	ip := fs.String("ip", "", "printer IP")
-	serial := fs.String("serial", "", "printer serial")
+	serial := fs.String("serial", "", "printer serial (default: read from the printer certificate)")
+	model := fs.String("model", "", "printer model (default: derived from the serial)")
 	accessFile := fs.String("access-code-file", "", "access code file")
 	username := fs.String("username", "", "username (default bblp)")
 	mqttPort := fs.Int("mqtt-port", 0, "mqtt port")
 	ftpPort := fs.Int("ftp-port", 0, "ftp port")
 	cameraPort := fs.Int("camera-port", 0, "camera port")
 	timeout := fs.Int("timeout", 0, "timeout seconds")
+	reconnectMax := fs.Int("reconnect-max", 0, "max seconds between reconnect attempts")
+	caFile := fs.String("ca-file", "", "CA certificate(s) the printer certificate must chain to")
+	bedType := fs.String("bed-type", "", "build plate installed (e.g. textured_plate, cool_plate)")
 	noCamera := fs.Bool("no-camera", false, "disable camera")
+	queueAutoConfirm := fs.Bool("queue-auto-confirm", false, "let queue run start jobs without asking whether the bed was cleared")
 	defaultProfile := fs.Bool("default", false, "set as default profile")
 	if err := fs.Parse(args); err != nil {
 		return errExit(err)
@@ -1262,9 +1914,34 @@ func cmdConfigSet(gf GlobalFlags, args []string) int {
 	if *timeout != 0 {
 		p.TimeoutSeconds = *timeout
 	}
+	if *reconnectMax != 0 {
+		p.ReconnectMaxSeconds = *reconnectMax
+	}
+	if *caFile != "" {
+		if _, err := printer.LoadCertPool(*caFile); err != nil {
+			return errExit(err)
+		}
+		p.CAFile = *caFile
+	}
 	if *noCamera {
 		p.NoCamera = true
 	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "queue-auto-confirm" {
+			p.QueueAutoConfirm = *queueAutoConfirm
+		}
+	})
+	if *model != "" {
+		p.Model = printer.NormalizeModel(*model)
+	}
+	if *bedType != "" {
+		p.BedType = threemf.BedTypeID(*bedType)
+	}
+	if (*ip != "" || *serial != "") && p.IP != "" {
+		if err := detectSerial(gf, &p); err != nil {
+			return errExit(err)
+		}
+	}
 	cfg.Profiles[*profile] = p
 	if *defaultProfile {
 		cfg.DefaultProfile = *profile
@@ -1276,6 +1953,36 @@ func cmdConfigSet(gf GlobalFlags, args []string) int {
 	return 0
 }
 
+// detectSerial reads the serial from the printer certificate and fills in or
+// verifies the profile's serial and model. An unreachable printer is only a
+// warning so profiles can be prepared offline.
+func detectSerial(gf GlobalFlags, p *config.Profile) error {
+	port := firstNonZero(p.MQTTPort, 8883)
+	chain, err := printer.ProbeCertificate(net.JoinHostPort(p.IP, strconv.Itoa(port)), 5*time.Second)
+	if err != nil {
+		if p.Serial == "" {
+			fmt.Fprintf(os.Stderr, "Warning: could not read the serial from the printer (%v); set it with --serial\n", err)
+		}
+		return nil
+	}
+	detected := printer.SerialFromCertificate(chain[0])
+	switch {
+	case p.Serial == "":
+		p.Serial = detected
+		if !gf.Quiet {
+			fmt.Fprintf(os.Stderr, "Detected serial %s\n", detected)
+		}
+	case !strings.EqualFold(p.Serial, detected):
+		if !gf.Force {
+			return fmt.Errorf("%w (pass --force to keep it)", &printer.SerialMismatchError{Configured: p.Serial, Printer: detected})
+		}
+	}
+	if p.Model == "" {
+		p.Model = printer.ModelFromSerial(p.Serial)
+	}
+	return nil
+}
+
 func cmdConfigRemove(gf GlobalFlags, args []string) int {
 	fs := flag.NewFlagSet("config remove", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
@@ -1300,6 +2007,111 @@ func cmdConfigRemove(gf GlobalFlags, args []string) int {
 	return 0
 }
 
+func cmdConfigTrust(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("config trust", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	profile := fs.String("printer", "", "profile name")
+	fingerprint := fs.String("fingerprint", "", "sha256 fingerprint to pin instead of the presented certificate")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	if *profile == "" {
+		return errExit(errors.New("config trust requires --printer"))
+	}
+	userPath, _, err := loadConfigForEdit(gf)
+	if err != nil {
+		return errExit(err)
+	}
+	// The pin lives with the profile, which may be in the project config.
+	cfgPath, cfg, err := profileConfig(userPath, *profile)
+	if err != nil {
+		return errExit(err)
+	}
+	if cfgPath == "" {
+		return errExit(fmt.Errorf("unknown printer profile %q", *profile))
+	}
+	p := cfg.Profiles[*profile]
+
+	fp := printer.NormalizeFingerprint(*fingerprint)
+	if fp == "" {
+		if p.IP == "" {
+			return errExit(fmt.Errorf("printer profile %q has no ip", *profile))
+		}
+		port := firstNonZero(p.MQTTPort, 8883)
+		timeout := time.Duration(firstNonZero(p.TimeoutSeconds, 10)) * time.Second
+		chain, err := printer.ProbeCertificate(net.JoinHostPort(p.IP, strconv.Itoa(port)), timeout)
+		if err != nil {
+			return errExit(err)
+		}
+		fp = printer.CertFingerprint(chain[0])
+		if !gf.Quiet {
+			fmt.Fprintf(os.Stderr, "Certificate: CN=%s issuer=%s\n", chain[0].Subject.CommonName, chain[0].Issuer.CommonName)
+		}
+	} else if len(fp) != 64 {
+		return errExit(fmt.Errorf("invalid sha256 fingerprint %q", *fingerprint))
+	}
+
+	if p.CertFingerprint == fp {
+		fmt.Fprintf(os.Stdout, "Already trusted: %s\n", fp)
+		return 0
+	}
+	if p.CertFingerprint != "" {
+		fmt.Fprintf(os.Stderr, "Replacing pinned certificate %s with %s\n", p.CertFingerprint, fp)
+		if err := ui.RequireConfirmation(ui.ConfirmOptions{
+			Action:  "trust " + *profile,
+			Force:   gf.Force,
+			Confirm: gf.Confirm,
+			NoInput: gf.NoInput,
+			UseTTY:  ui.IsTerminal(os.Stdin),
+			Out:     os.Stderr,
+		}); err != nil {
+			return errExit(err)
+		}
+	}
+	if gf.DryRun {
+		fmt.Fprintf(os.Stdout, "Would pin %s for %s\n", fp, *profile)
+		return 0
+	}
+	p.CertFingerprint = fp
+	cfg.Profiles[*profile] = p
+	if err := config.Save(cfgPath, cfg); err != nil {
+		return errExit(err)
+	}
+	fmt.Fprintf(os.Stdout, "Trusted: %s\n", fp)
+	return 0
+}
+
+func cmdConfigUntrust(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("config untrust", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	profile := fs.String("printer", "", "profile name")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	if *profile == "" {
+		return errExit(errors.New("config untrust requires --printer"))
+	}
+	userPath, _, err := loadConfigForEdit(gf)
+	if err != nil {
+		return errExit(err)
+	}
+	// The pin lives with the profile, which may be in the project config.
+	cfgPath, cfg, err := profileConfig(userPath, *profile)
+	if err != nil {
+		return errExit(err)
+	}
+	if cfgPath == "" {
+		return errExit(fmt.Errorf("unknown printer profile %q", *profile))
+	}
+	p := cfg.Profiles[*profile]
+	p.CertFingerprint = ""
+	cfg.Profiles[*profile] = p
+	if err := config.Save(cfgPath, cfg); err != nil {
+		return errExit(err)
+	}
+	return 0
+}
+
 func cmdDoctor(gf GlobalFlags, _ []string) int {
 	res, err := resolvePrinter(gf, false, false)
 	if err != nil {
@@ -1314,7 +2126,7 @@ func cmdDoctor(gf GlobalFlags, _ []string) int {
 		{name: "camera", port: res.CameraPort},
 	}
 	for _, p := range ports {
-		addr := fmt.Sprintf("%s:%d", res.IP, p.port)
+		addr := net.JoinHostPort(res.IP, strconv.Itoa(p.port))
 		conn, err := net.DialTimeout("tcp", addr, res.Timeout)
 		if err != nil {
 			fmt.Fprintf(os.Stdout, "%s: failed (%v)\n", p.name, err)
@@ -1323,6 +2135,25 @@ func cmdDoctor(gf GlobalFlags, _ []string) int {
 		_ = conn.Close()
 		fmt.Fprintf(os.Stdout, "%s: ok\n", p.name)
 	}
+
+	chain, err := printer.ProbeCertificate(net.JoinHostPort(res.IP, strconv.Itoa(res.MQTTPort)), res.Timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "certificate: failed (%v)\n", err)
+		return 0
+	}
+	detected := printer.SerialFromCertificate(chain[0])
+	model := printer.ModelFromSerial(detected)
+	if model == "" {
+		model = "unknown model"
+	}
+	switch {
+	case res.Serial == "":
+		fmt.Fprintf(os.Stdout, "serial: %s (%s, not configured)\n", detected, model)
+	case strings.EqualFold(res.Serial, detected):
+		fmt.Fprintf(os.Stdout, "serial: ok (%s, %s)\n", detected, model)
+	default:
+		fmt.Fprintf(os.Stdout, "serial: mismatch (configured %s, printer reports %s)\n", res.Serial, detected)
+	}
 	return 0
 }
 
@@ -1357,6 +2188,8 @@ func lookupConfigValue(cfg config.Config, profileName, key string) any {
 		return p.IP
 	case "serial":
 		return p.Serial
+	case "model":
+		return p.Model
 	case "access_code_file":
 		return p.AccessCodeFile
 	case "username":
@@ -1369,14 +2202,24 @@ func lookupConfigValue(cfg config.Config, profileName, key string) any {
 		return p.CameraPort
 	case "timeout_seconds":
 		return p.TimeoutSeconds
+	case "reconnect_max_seconds":
+		return p.ReconnectMaxSeconds
+	case "cert_fingerprint":
+		return p.CertFingerprint
+	case "ca_file":
+		return p.CAFile
+	case "bed_type":
+		return p.BedType
 	case "no_camera":
 		return p.NoCamera
+	case "queue_auto_confirm":
+		return p.QueueAutoConfirm
 	default:
 		return nil
 	}
 }
 
-func writeAMSPlain(w io.Writer, amsInfo any) error {
+func writeAMSPlain(w io.Writer, amsInfo *printer.AMSReport) error {
 	data, err := json.Marshal(amsInfo)
 	if err != nil {
 		return err
@@ -1385,43 +2228,23 @@ func writeAMSPlain(w io.Writer, amsInfo any) error {
 	return err
 }
 
-func writeAMSHuman(w io.Writer, amsInfo any) error {
-	info, ok := amsInfo.(map[string]any)
-	if !ok {
+func writeAMSHuman(w io.Writer, amsInfo *printer.AMSReport) error {
+	if amsInfo == nil {
 		_, err := fmt.Fprintln(w, "No AMS data")
 		return err
 	}
-	if v, ok := info["ams_exist_bits"]; ok {
-		if s, ok := v.(string); ok && s == "0" {
-			_, err := fmt.Fprintln(w, "No AMS connected")
-			return err
-		}
+	if amsInfo.AMSExistBits == "0" {
+		_, err := fmt.Fprintln(w, "No AMS connected")
+		return err
 	}
-	amsList, ok := info["ams"].([]any)
-	if !ok || len(amsList) == 0 {
+	if len(amsInfo.Units) == 0 {
 		_, err := fmt.Fprintln(w, "No AMS units found")
 		return err
 	}
-	for _, unit := range amsList {
-		m, ok := unit.(map[string]any)
-		if !ok {
-			continue
-		}
-		id := fmt.Sprintf("%v", m["id"])
-		humidity := fmt.Sprintf("%v", m["humidity"])
-		temp := fmt.Sprintf("%v", m["temp"])
-		fmt.Fprintf(w, "AMS %s: humidity=%s temp=%s\n", id, humidity, temp)
-		trays, _ := m["tray"].([]any)
-		for _, tray := range trays {
-			tr, ok := tray.(map[string]any)
-			if !ok {
-				continue
-			}
-			trayID := fmt.Sprintf("%v", tr["id"])
-			name := fmt.Sprintf("%v", tr["tray_id_name"])
-			typeName := fmt.Sprintf("%v", tr["tray_type"])
-			color := fmt.Sprintf("%v", tr["tray_color"])
-			fmt.Fprintf(w, "  tray %s: name=%s type=%s color=%s\n", trayID, name, typeName, color)
+	for _, unit := range amsInfo.Units {
+		fmt.Fprintf(w, "AMS %s: humidity=%s temp=%s\n", unit.ID, unit.Humidity, unit.Temp)
+		for _, tr := range unit.Trays {
+			fmt.Fprintf(w, "  tray %s: name=%s type=%s color=%s\n", tr.ID, tr.TrayIDName, tr.TrayType, tr.TrayColor)
 		}
 	}
 	return nil
@@ -1444,14 +2267,37 @@ func printStatusHuman(status printer.Status) {
 	if status.RemainingMinutes != nil {
 		fmt.Fprintf(os.Stdout, "Remaining: %d min\n", *status.RemainingMinutes)
 	}
+	if status.SpeedLevel != "" {
+		fmt.Fprintf(os.Stdout, "Speed: %s (%d%%)\n", status.SpeedLevel, status.SpeedMagnitude)
+	}
 	if status.File != "" {
 		fmt.Fprintf(os.Stdout, "File: %s\n", status.File)
 	}
+	if len(status.SkippedObjects) > 0 {
+		fmt.Fprintf(os.Stdout, "Skipped objects: %s\n", joinInts(status.SkippedObjects))
+	}
 	fmt.Fprintf(os.Stdout, "Light: %s\n", status.Light)
 	if status.WifiSignal != "" {
 		fmt.Fprintf(os.Stdout, "WiFi: %s dBm\n", status.WifiSignal)
 	}
-	fmt.Fprintf(os.Stdout, "Error: %d\n", status.ErrorCode)
+	if status.Error != nil {
+		desc := status.Error.Description
+		if desc == "" {
+			desc = "unknown error"
+		}
+		fmt.Fprintf(os.Stdout, "Error: %s %s\n", status.Error.Hex, desc)
+		if status.Error.Action != "" {
+			fmt.Fprintf(os.Stdout, "Action: %s\n", status.Error.Action)
+		}
+	} else {
+		fmt.Fprintln(os.Stdout, "Error: none")
+	}
+	if len(status.HMS) > 0 {
+		fmt.Fprintln(os.Stdout, "HMS:")
+		for _, a := range status.HMS {
+			fmt.Fprintf(os.Stdout, "  %s\n", formatHMSAlert(a))
+		}
+	}
 }
 
 func fmtFloat(v float64) string {
@@ -1475,6 +2321,17 @@ func plateToLocation(plate string) string {
 	return plate
 }
 
+// plateNumber extracts N from a "Metadata/plate_N.gcode" location, or
+// returns 0.
+func plateNumber(location string) int {
+	base := strings.TrimSuffix(path.Base(location), ".gcode")
+	n, err := strconv.Atoi(strings.TrimPrefix(base, "plate_"))
+	if err != nil || !strings.HasPrefix(base, "plate_") {
+		return 0
+	}
+	return n
+}
+
 func defaultRemoteName(path string) string {
 	base := filepath.Base(path)
 	lower := strings.ToLower(base)
@@ -1540,11 +2397,54 @@ func envInt(key string) int {
 	return i
 }
 
+// printerEnv reads an environment variable describing a single printer; it
+// is ignored when gf selects profiles only.
+func printerEnv(gf GlobalFlags, key string) string {
+	if gf.ProfileOnly {
+		return ""
+	}
+	return os.Getenv(key)
+}
+
+func printerEnvInt(gf GlobalFlags, key string) int {
+	if gf.ProfileOnly {
+		return 0
+	}
+	return envInt(key)
+}
+
 func envBool(key string) bool {
 	v := strings.ToLower(os.Getenv(key))
 	return v == "1" || v == "true" || v == "yes"
 }
 
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// parseDuration accepts Go durations ("90m") or plain seconds ("300").
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if v != "" {
@@ -1563,9 +2463,35 @@ func firstNonZero(values ...int) int {
 	return 0
 }
 
+// Exit codes beyond the generic 1 (error) and 2 (usage), so scripts can tell
+// why a command failed.
+const (
+	exitRejected     = 3
+	exitTimeout      = 4
+	exitPrintFailed  = 5
+	exitPrinterError = 6
+	exitPrintStopped = 7
+)
+
 func errExit(err error) int {
 	fmt.Fprintln(os.Stderr, "Error:", err)
-	return 1
+	var pinErr *printer.FingerprintMismatchError
+	if errors.As(err, &pinErr) {
+		fmt.Fprintln(os.Stderr, "The printer certificate changed. If the printer was reset or replaced, re-pin it with: bambu-cli config trust --printer <name>")
+	}
+	return exitCode(err)
+}
+
+func exitCode(err error) int {
+	var cmdErr *printer.CommandError
+	switch {
+	case errors.As(err, &cmdErr):
+		return exitRejected
+	case errors.Is(err, printer.ErrReplyTimeout), errors.Is(err, errWaitTimeout):
+		return exitTimeout
+	default:
+		return 1
+	}
 }
 
 func exitOnErr(err error) int {
@@ -1575,6 +2501,10 @@ func exitOnErr(err error) int {
 	return 0
 }
 
+func exitOnReply(_ printer.Reply, err error) int {
+	return exitOnErr(err)
+}
+
 func printUsage() {
 	fmt.Fprintln(os.Stdout, "bambu-cli - control and monitor BambuLab printers")
 	fmt.Fprintln(os.Stdout, "")
@@ -1586,18 +2516,25 @@ func printUsage() {
 	fmt.Fprintln(os.Stdout, "  watch                 Watch printer status")
 	fmt.Fprintln(os.Stdout, "  light on|off|status    Control printer light")
 	fmt.Fprintln(os.Stdout, "  temps get|set          Get or set temperatures")
-	fmt.Fprintln(os.Stdout, "  print start|pause|resume|stop")
+	fmt.Fprintln(os.Stdout, "  print start|pause|resume|stop|inspect|skip|speed")
 	fmt.Fprintln(os.Stdout, "  files list|upload|download|delete")
 	fmt.Fprintln(os.Stdout, "  camera snapshot        Save camera frame")
 	fmt.Fprintln(os.Stdout, "  gcode send             Send gcode line(s)")
 	fmt.Fprintln(os.Stdout, "  ams status             Show AMS status")
+	fmt.Fprintln(os.Stdout, "  hms                    Show health alerts")
 	fmt.Fprintln(os.Stdout, "  calibrate              Run calibration")
 	fmt.Fprintln(os.Stdout, "  home                   Home printer")
 	fmt.Fprintln(os.Stdout, "  move z                 Move Z axis")
 	fmt.Fprintln(os.Stdout, "  fans set               Set fan speeds")
 	fmt.Fprintln(os.Stdout, "  reboot                 Reboot printer")
-	fmt.Fprintln(os.Stdout, "  config get|set|list|remove")
+	fmt.Fprintln(os.Stdout, "  config get|set|list|remove|trust|untrust")
 	fmt.Fprintln(os.Stdout, "  doctor                 Check connectivity")
+	fmt.Fprintln(os.Stdout, "  record --out <file>    Record raw printer reports")
+	fmt.Fprintln(os.Stdout, "  queue add|list|remove|run")
+	fmt.Fprintln(os.Stdout, "  fleet status           Status of every configured printer")
+	fmt.Fprintln(os.Stdout, "  fleet print <file>     Start a job on the best available printer")
+	fmt.Fprintln(os.Stdout, "  history list|export|stats")
+	fmt.Fprintln(os.Stdout, "  simulate               Run a local printer simulator")
 	fmt.Fprintln(os.Stdout, "  help [command]         Show help")
 	fmt.Fprintln(os.Stdout, "")
 	fmt.Fprintln(os.Stdout, "GLOBAL FLAGS:")
@@ -1619,6 +2556,8 @@ func printUsage() {
 	fmt.Fprintln(os.Stdout, "  --no-camera")
 	fmt.Fprintln(os.Stdout, "  --timeout <seconds>")
 	fmt.Fprintln(os.Stdout, "  --config <path>")
+	fmt.Fprintln(os.Stdout, "  --replay <file>")
+	fmt.Fprintln(os.Stdout, "  --replay-speed <factor>")
 }
 
 func printCommandUsage(cmd string) {
@@ -1626,16 +2565,28 @@ func printCommandUsage(cmd string) {
 	case "status":
 		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli status")
 	case "watch":
-		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli watch [--interval <seconds>] [--refresh]")
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli watch [--interval <seconds>] [--refresh] [--until <cond>]... [--timeout <duration>]")
+		fmt.Fprintln(os.Stdout, "  while the printer is unreachable, watch reports the connection state instead of stale status")
+		fmt.Fprintln(os.Stdout, "  conditions: state=FINISH, state in (FINISH,IDLE), layer>=20, percent>=50, nozzle_temp>=215")
+		fmt.Fprintln(os.Stdout, "  fields: state stage percent layer layer_total remaining bed_temp nozzle_temp chamber_temp error_code")
+		fmt.Fprintln(os.Stdout, "  a failed print (exit 5) or fatal HMS error (exit 6) ends the watch before any condition is checked")
 	case "light":
 		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli light on|off|status")
 	case "temps":
 		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli temps get|set [--bed <C>] [--nozzle <C>] [--chamber <C>]")
 	case "print":
-		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli print start <file> [--plate <n|path>] [--no-upload]")
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli print start <file> [--plate <n|path>] [--no-upload] [--ams-mapping <list>]")
+		fmt.Fprintln(os.Stdout, "  without --ams-mapping, 3MF filaments are matched to loaded trays by material and color")
+		fmt.Fprintln(os.Stdout, "  pre-flight checks (state, storage, model, nozzle, bed, filament) run first; --force overrides")
+		fmt.Fprintln(os.Stdout, "  --follow shows progress until the print ends; exit 0 finished, 5 failed, 7 stopped")
+		fmt.Fprintln(os.Stdout, "  options: --bed-type <id> --timelapse --bed-leveling=false --vibration-cali=false --layer-inspect --md5 <hex>")
 		fmt.Fprintln(os.Stdout, "       bambu-cli print pause|resume|stop")
+		fmt.Fprintln(os.Stdout, "       bambu-cli print inspect <file> [--remote] [--plate <n>]")
+		fmt.Fprintln(os.Stdout, "       bambu-cli print speed silent|standard|sport|ludicrous")
+		fmt.Fprintln(os.Stdout, "       bambu-cli print skip [<id>...] [--file <remote.3mf>] [--plate <n>]")
+		fmt.Fprintln(os.Stdout, "  without IDs, print skip lists the objects of the running job")
 	case "files":
-		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli files list [--dir <path>]")
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli files list [--dir <path>] [--long|-l] [--recursive|-R] [--sort name|size|time]")
 		fmt.Fprintln(os.Stdout, "       bambu-cli files upload <local> [--as <remote>]")
 		fmt.Fprintln(os.Stdout, "       bambu-cli files download <remote> --out <path|->")
 		fmt.Fprintln(os.Stdout, "       bambu-cli files delete <remote>")
@@ -1643,8 +2594,25 @@ func printCommandUsage(cmd string) {
 		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli camera snapshot [--out <path|->]")
 	case "gcode":
 		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli gcode send <line...> | --stdin")
+	case "fleet":
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli fleet status [--workers <n>]")
+		fmt.Fprintln(os.Stdout, "       bambu-cli fleet print [--policy first|random|filament] [--workers <n>] [print start options] <file>")
+		fmt.Fprintln(os.Stdout, "  fleet status exits 1 when any printer is unreachable")
+	case "queue":
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli queue add <file> [--printer <name>] [print start options]")
+		fmt.Fprintln(os.Stdout, "       bambu-cli queue list [--printer <name>]")
+		fmt.Fprintln(os.Stdout, "       bambu-cli queue remove <id>...")
+		fmt.Fprintln(os.Stdout, "       bambu-cli queue run [--printer <name>] [--auto-confirm | --bed-cleared] [--once] [--wait <duration>]")
+		fmt.Fprintln(os.Stdout, "  queue run waits for the printer to finish, asks you to confirm the bed was cleared, then starts the next job")
+	case "history":
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli history list [--limit <n>] [filters]")
+		fmt.Fprintln(os.Stdout, "       bambu-cli history export [--format csv|json] [--out <path|->] [filters]")
+		fmt.Fprintln(os.Stdout, "       bambu-cli history stats [filters]")
+		fmt.Fprintln(os.Stdout, "  filters: --printer <name> --outcome <finished|failed|stopped|unknown|running> --since <date|duration>")
 	case "ams":
 		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli ams status")
+	case "hms":
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli hms")
 	case "calibrate":
 		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli calibrate [--no-bed-level] [--no-motor-noise] [--no-vibration]")
 	case "home":
@@ -1656,7 +2624,17 @@ func printCommandUsage(cmd string) {
 	case "reboot":
 		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli reboot")
 	case "config":
-		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli config list|get|set|remove")
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli config list|get|set|remove|trust|untrust")
+		fmt.Fprintln(os.Stdout, "  config trust --printer <name> [--fingerprint <sha256>]   pin the printer certificate")
+		fmt.Fprintln(os.Stdout, "  config untrust --printer <name>                          forget the pin (re-pinned on next use)")
+	case "record":
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli record --out <file|-> [--duration <duration>]")
+		fmt.Fprintln(os.Stdout, "  replay with: bambu-cli --replay <file> [--replay-speed <factor>] status|watch|temps get|ams status|hms")
+	case "simulate":
+		fmt.Fprintln(os.Stdout, "USAGE: bambu-cli simulate [--bind <addr>] [--serial <serial>] [--access-code <code>]")
+		fmt.Fprintln(os.Stdout, "       [--mqtt-port <port>] [--ftp-port <port>] [--camera-port <port>] [--dir <path>]")
+		fmt.Fprintln(os.Stdout, "       [--tick <duration>] [--layers <n>] [--pause-at-layer <n>] [--fail-at-layer <n>]")
+		fmt.Fprintln(os.Stdout, "       [--drop-transfer-after <bytes>]")
 	default:
 		printUsage()
 	}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"bambu-cli/internal/printer"
+	"bambu-cli/internal/threemf"
+)
+
+// Pre-flight check results.
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+type preflightCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// preflightJob is what is about to be printed. Model and Plate are empty for
+// plain gcode; Mapping is nil when the AMS is not used.
+type preflightJob struct {
+	Model   string
+	Plate   *threemf.Plate
+	Mapping *printer.AMSMapping
+}
+
+// preflightChecks compares a job with the printer's current report before
+// anything is uploaded.
+func preflightChecks(res ResolvedPrinter, report printer.PrintReport, job preflightJob) []preflightCheck {
+	var checks []preflightCheck
+	add := func(name, status, detail string, args ...any) {
+		checks = append(checks, preflightCheck{Name: name, Status: status, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	state := printer.ParseGcodeState(report.GcodeState)
+	switch state {
+	case printer.GcodeStateIdle, printer.GcodeStateFinish, printer.GcodeStateFailed:
+		add("state", checkOK, "printer is %s", state)
+	case printer.GcodeStateUnknown:
+		add("state", checkFail, "printer did not report its state")
+	default:
+		add("state", checkFail, "printer is %s; a job is in progress", state)
+	}
+
+	if report.SDCard {
+		add("storage", checkOK, "storage present")
+	} else {
+		add("storage", checkFail, "no SD card / storage reported")
+	}
+
+	switch {
+	case job.Model == "":
+		add("model", checkSkip, "job does not name a printer model")
+	case res.Model == "":
+		add("model", checkSkip, "printer model unknown; set it with config set --model")
+	case printer.SameModel(job.Model, res.Model):
+		add("model", checkOK, "sliced for %s", job.Model)
+	default:
+		add("model", checkFail, "sliced for %s, printer is %s", job.Model, res.Model)
+	}
+
+	if job.Plate == nil {
+		return checks
+	}
+	plate := job.Plate
+
+	printerNozzle, _ := strconv.ParseFloat(report.NozzleDiameter, 64)
+	switch {
+	case plate.NozzleDiameter == 0:
+		add("nozzle", checkSkip, "job does not name a nozzle diameter")
+	case printerNozzle == 0:
+		add("nozzle", checkSkip, "printer did not report its nozzle diameter")
+	case plate.NozzleDiameter == printerNozzle:
+		add("nozzle", checkOK, "%s mm", fmtFloat(printerNozzle))
+	default:
+		add("nozzle", checkFail, "sliced for %s mm, printer has %s mm", fmtFloat(plate.NozzleDiameter), fmtFloat(printerNozzle))
+	}
+
+	switch {
+	case plate.BedType == "":
+		add("bed", checkSkip, "job does not name a bed type")
+	case res.BedType == "":
+		add("bed", checkSkip, "installed plate unknown; set it with config set --bed-type")
+	case plate.BedType == res.BedType:
+		add("bed", checkOK, "%s", plate.BedType)
+	default:
+		add("bed", checkFail, "sliced for %s, %s installed", plate.BedType, res.BedType)
+	}
+
+	if job.Mapping == nil {
+		add("filament", checkSkip, "no AMS mapping to check")
+		return checks
+	}
+	for _, m := range job.Mapping.Missing {
+		if !hasChoice(job.Mapping, m.Slot) {
+			add("filament", checkFail, "slot %d %s: no tray loaded", m.Slot, m.Type)
+		}
+	}
+	needed := map[int]float64{}
+	for _, c := range job.Mapping.Choices {
+		needed[c.Tray.Index] += gramsForSlot(plate, c.Request.Slot)
+	}
+	for _, c := range job.Mapping.Choices {
+		label := fmt.Sprintf("slot %d %s -> %s", c.Request.Slot, c.Request.Type, c.Tray.Label())
+		if c.TypeMismatch {
+			add("filament", checkFail, "%s holds %s", label, c.Tray.Type)
+			continue
+		}
+		left, known := c.Tray.RemainingGrams()
+		need := needed[c.Tray.Index]
+		switch {
+		case !known:
+			add("filament", checkOK, "%s, remaining unknown", label)
+		case left < need:
+			add("filament", checkFail, "%s: %.0f g left, job needs %.1f g", label, left, need)
+		default:
+			add("filament", checkOK, "%s: %.0f g left, job needs %.1f g", label, left, need)
+		}
+	}
+	return checks
+}
+
+func hasChoice(m *printer.AMSMapping, slot int) bool {
+	for _, c := range m.Choices {
+		if c.Request.Slot == slot {
+			return true
+		}
+	}
+	return false
+}
+
+func gramsForSlot(plate *threemf.Plate, slot int) float64 {
+	for _, f := range plate.Filaments {
+		if f.ID == slot {
+			return f.UsedGrams
+		}
+	}
+	return 0
+}
+
+func preflightFailed(checks []preflightCheck) bool {
+	for _, c := range checks {
+		if c.Status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+func writePreflight(w io.Writer, checks []preflightCheck) {
+	fmt.Fprintln(w, "Pre-flight:")
+	for _, c := range checks {
+		mark := "[ok]  "
+		switch c.Status {
+		case checkFail:
+			mark = "[FAIL]"
+		case checkSkip:
+			mark = "[skip]"
+		}
+		fmt.Fprintf(w, "  %s %-8s %s\n", mark, c.Name, c.Detail)
+	}
+}
+
+// healthCheck fails while the printer reports HMS alerts above info level.
+func healthCheck(report printer.PrintReport) preflightCheck {
+	var active []string
+	for _, a := range printer.DecodeHMS(report.HMS) {
+		if a.Severity != "info" {
+			active = append(active, a.Code)
+		}
+	}
+	if len(active) > 0 {
+		return preflightCheck{Name: "hms", Status: checkFail, Detail: "active alerts " + strings.Join(active, ", ")}
+	}
+	return preflightCheck{Name: "hms", Status: checkOK, Detail: "no active alerts"}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"bambu-cli/internal/output"
+	"bambu-cli/internal/printer"
+	"bambu-cli/internal/queue"
+	"bambu-cli/internal/ui"
+)
+
+func cmdQueue(gf GlobalFlags, args []string) int {
+	if len(args) == 0 {
+		printCommandUsage("queue")
+		return 2
+	}
+	sub := args[0]
+	subargs := args[1:]
+	switch sub {
+	case "add":
+		return cmdQueueAdd(gf, subargs)
+	case "list":
+		return cmdQueueList(gf, subargs)
+	case "remove":
+		return cmdQueueRemove(gf, subargs)
+	case "run":
+		return cmdQueueRun(gf, subargs)
+	default:
+		printCommandUsage("queue")
+		return 2
+	}
+}
+
+func cmdQueueAdd(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("queue add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	profile := fs.String("printer", "", "printer profile to print on (default: the current profile)")
+	o := addPrintStartFlags(fs)
+	// Flags may follow the file, as in "queue add part.3mf --plate 2".
+	var files []string
+	rest := args
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return errExit(err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+	if len(files) != 1 {
+		return errExit(errors.New("queue add requires one file path"))
+	}
+	if *o.follow {
+		return errExit(errors.New("--follow cannot be queued; queue run always follows the job"))
+	}
+	// A local file is stored by absolute path so queue run works from any
+	// directory; with --no-upload it names a file on the printer.
+	file := files[0]
+	if !*o.noUpload {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return errExit(err)
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return errExit(err)
+		}
+		file = abs
+	}
+
+	if *profile != "" {
+		gf.Printer = *profile
+	}
+	res, err := resolvePrinter(gf, false, false)
+	if err != nil {
+		return errExit(err)
+	}
+	job := queue.Job{
+		File:    file,
+		Plate:   *o.plate,
+		Printer: res.ProfileName,
+		Added:   time.Now().UTC().Truncate(time.Second),
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "printer" && f.Name != "plate" {
+			job.Options = append(job.Options, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+
+	if gf.DryRun {
+		fmt.Fprintf(os.Stdout, "Would queue %s\n", file)
+		return 0
+	}
+	path, err := dataPath(gf, "queue.json")
+	if err != nil {
+		return errExit(err)
+	}
+	q, err := queue.Read(path)
+	if err != nil {
+		return errExit(err)
+	}
+	job = q.Add(job)
+	if err := queue.Save(path, q); err != nil {
+		return errExit(err)
+	}
+
+	switch selectFormat(gf) {
+	case output.JSON:
+		return exitOnErr(output.WriteJSON(os.Stdout, job))
+	case output.Plain:
+		fmt.Fprintln(os.Stdout, job.ID)
+	default:
+		fmt.Fprintf(os.Stdout, "Queued job %d: %s\n", job.ID, describeJob(job))
+	}
+	return 0
+}
+
+func cmdQueueList(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("queue list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	profile := fs.String("printer", "", "only list jobs for this profile")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	path, err := dataPath(gf, "queue.json")
+	if err != nil {
+		return errExit(err)
+	}
+	q, err := queue.Read(path)
+	if err != nil {
+		return errExit(err)
+	}
+	jobs := make([]queue.Job, 0, len(q.Jobs))
+	for _, j := range q.Jobs {
+		if *profile == "" || j.Printer == *profile {
+			jobs = append(jobs, j)
+		}
+	}
+
+	switch selectFormat(gf) {
+	case output.JSON:
+		return exitOnErr(output.WriteJSON(os.Stdout, map[string]any{"jobs": jobs}))
+	case output.Plain:
+		for _, j := range jobs {
+			fmt.Fprintf(os.Stdout, "%d\t%s\t%s\t%s\t%s\t%s\n", j.ID, j.Printer, j.File, j.Plate,
+				j.Added.Format(time.RFC3339), strings.Join(j.Options, " "))
+		}
+		return 0
+	default:
+		if len(jobs) == 0 {
+			fmt.Fprintln(os.Stdout, "Queue is empty")
+			return 0
+		}
+		for _, j := range jobs {
+			fmt.Fprintf(os.Stdout, "%-4d %-10s %s  (added %s)\n", j.ID, firstNonEmpty(j.Printer, "-"), describeJob(j),
+				j.Added.Local().Format("2006-01-02 15:04"))
+		}
+		return 0
+	}
+}
+
+func cmdQueueRemove(gf GlobalFlags, args []string) int {
+	if len(args) == 0 {
+		return errExit(errors.New("queue remove requires job IDs"))
+	}
+	var ids []int
+	for _, arg := range args {
+		list, err := parseIntList(arg)
+		if err != nil {
+			return errExit(err)
+		}
+		ids = append(ids, list...)
+	}
+	path, err := dataPath(gf, "queue.json")
+	if err != nil {
+		return errExit(err)
+	}
+	q, err := queue.Read(path)
+	if err != nil {
+		return errExit(err)
+	}
+	for _, id := range ids {
+		if !q.Remove(id) {
+			return errExit(fmt.Errorf("no queued job %d", id))
+		}
+	}
+	if gf.DryRun {
+		fmt.Fprintf(os.Stdout, "Would remove jobs %s\n", joinInts(ids))
+		return 0
+	}
+	return exitOnErr(queue.Save(path, q))
+}
+
+// cmdQueueRun starts the queued jobs for one printer in order. Before each
+// job it waits for the printer to be done with the previous one and for the
+// bed to be cleared, then runs print start --follow with the stored options.
+func cmdQueueRun(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("queue run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	profile := fs.String("printer", "", "printer profile to run the queue for")
+	autoConfirm := fs.Bool("auto-confirm", false, "don't ask whether the bed was cleared")
+	bedCleared := fs.Bool("bed-cleared", false, "the bed is clear now: start the first job without asking")
+	once := fs.Bool("once", false, "start one job and stop")
+	wait := fs.Duration("wait", 0, "give up when the printer is not ready for the next job within this long (default: no limit)")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	if *profile != "" {
+		gf.Printer = *profile
+	}
+	res, err := resolvePrinter(gf, true, true)
+	if err != nil {
+		return errExit(err)
+	}
+	gf.Printer = res.ProfileName
+	path, err := dataPath(gf, "queue.json")
+	if err != nil {
+		return errExit(err)
+	}
+
+	for {
+		q, err := queue.Read(path)
+		if err != nil {
+			return errExit(err)
+		}
+		job, ok := q.Next(res.ProfileName)
+		if !ok {
+			if !gf.Quiet {
+				fmt.Fprintln(os.Stderr, "Queue is empty")
+			}
+			return 0
+		}
+		if gf.DryRun {
+			fmt.Fprintf(os.Stdout, "Would start queued job %d: %s\n", job.ID, describeJob(job))
+			return 0
+		}
+
+		last, err := waitForIdle(gf, res, *wait)
+		if err != nil {
+			return errExit(err)
+		}
+		// --force is left to print start, where it overrides failed
+		// pre-flight checks; it does not answer the bed prompt.
+		startGF := gf
+		startGF.Confirm = ""
+		// Stdin has been read already, for the access code or the prompt.
+		startGF.AccessCode, startGF.AccessCodeStdin = res.AccessCode, false
+		if *autoConfirm || res.QueueAutoConfirm || *bedCleared {
+			// Nobody may be watching, so print start must not ask either.
+			startGF.NoInput = true
+		} else {
+			if last != printer.GcodeStateIdle {
+				fmt.Fprintf(os.Stderr, "Last print ended %s. Next: job %d, %s\n", last, job.ID, describeJob(job))
+			}
+			if gf.Confirm == "" && (gf.NoInput || !ui.IsTerminal(os.Stdin)) {
+				return errExit(errors.New(`confirmation required: pass --bed-cleared, --auto-confirm or --confirm="bed cleared"`))
+			}
+			if err := ui.RequireConfirmation(ui.ConfirmOptions{
+				Action:  "bed cleared",
+				Confirm: gf.Confirm,
+				NoInput: gf.NoInput,
+				UseTTY:  ui.IsTerminal(os.Stdin),
+				Out:     os.Stderr,
+			}); err != nil {
+				return errExit(err)
+			}
+		}
+		*bedCleared = false
+
+		if !gf.Quiet {
+			fmt.Fprintf(os.Stderr, "Starting job %d: %s\n", job.ID, describeJob(job))
+		}
+		startArgs := append([]string{"--plate", job.Plate, "--follow"}, job.Options...)
+		code := cmdPrintStart(startGF, append(startArgs, job.File))
+		switch code {
+		case 0, exitPrintFailed, exitPrintStopped:
+			// The job ran; take it off the queue whatever the outcome.
+			if err := removeQueued(path, job.ID); err != nil {
+				return errExit(err)
+			}
+		}
+		if code != 0 {
+			fmt.Fprintf(os.Stderr, "Queue stopped at job %d\n", job.ID)
+			return code
+		}
+		if *once {
+			return 0
+		}
+	}
+}
+
+// errWaitTimeout ends queue run when the printer is not ready within --wait.
+var errWaitTimeout = errors.New("timed out waiting for the printer to be ready")
+
+// waitForIdle blocks until the printer has no job in progress and returns
+// the state it settled in. Connection changes are reported as watch does.
+// A limit above zero bounds the wait.
+func waitForIdle(gf GlobalFlags, res ResolvedPrinter, limit time.Duration) (printer.GcodeState, error) {
+	client, err := dialMQTT(res)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	events, unsubscribe := client.Subscribe(64)
+	defer unsubscribe()
+	_ = client.PushAll()
+	_ = client.WaitForData(res.Timeout)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	var deadline <-chan time.Time
+	if limit > 0 {
+		timer := time.NewTimer(limit)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	waiting := false
+	lastConn := printer.ConnConnected
+	for {
+		conn := client.Connection()
+		if conn.State != lastConn {
+			if err := writeConnection(gf, conn); err != nil {
+				return "", err
+			}
+			lastConn = conn.State
+		}
+		state := printer.ParseGcodeState(client.Report().GcodeState)
+		if conn.State == printer.ConnConnected {
+			switch state {
+			case printer.GcodeStateIdle, printer.GcodeStateFinish, printer.GcodeStateFailed:
+				return state, nil
+			}
+		}
+		if !waiting && !gf.Quiet {
+			fmt.Fprintf(os.Stderr, "Waiting for the printer to finish (%s)...\n", state)
+			waiting = true
+		}
+		select {
+		case <-events:
+			drainEvents(events)
+		case <-ticker.C:
+			_ = client.PushAll()
+		case <-deadline:
+			return "", fmt.Errorf("%w after %s (printer is %s, connection %s)", errWaitTimeout, limit, state, conn.State)
+		}
+	}
+}
+
+func removeQueued(path string, id int) error {
+	q, err := queue.Read(path)
+	if err != nil {
+		return err
+	}
+	q.Remove(id)
+	return queue.Save(path, q)
+}
+
+func describeJob(j queue.Job) string {
+	s := filepath.Base(j.File)
+	if j.Plate != "" {
+		if _, err := strconv.Atoi(j.Plate); err == nil {
+			s += " plate " + j.Plate
+		} else {
+			s += " " + j.Plate
+		}
+	}
+	if len(j.Options) > 0 {
+		s += " " + strings.Join(j.Options, " ")
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"bambu-cli/internal/printer"
+)
+
+func cmdRecord(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	out := fs.String("out", "", "file to write (- for stdout)")
+	duration := fs.String("duration", "", "stop after duration (default: until interrupted)")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	if *out == "" {
+		return errExit(errors.New("--out is required"))
+	}
+	limit, err := parseDuration(*duration)
+	if err != nil {
+		return errExit(err)
+	}
+
+	res, err := resolvePrinter(gf, true, true)
+	if err != nil {
+		return errExit(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return errExit(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	recorder := printer.NewRecorder(w)
+
+	opts := mqttOptions(res)
+	opts.Recorder = recorder
+	client, err := printer.NewMQTTClient(res.IP, res.AccessCode, res.Serial, opts)
+	if err != nil {
+		return errExit(err)
+	}
+	defer client.Close()
+
+	_ = client.PushAll()
+	if err := client.WaitForData(res.Timeout); err != nil {
+		return errExit(err)
+	}
+	if !gf.Quiet {
+		fmt.Fprintln(os.Stderr, "Recording; press Ctrl-C to stop.")
+	}
+
+	var deadline <-chan time.Time
+	if limit > 0 {
+		timer := time.NewTimer(limit)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sig:
+	case <-deadline:
+	}
+	client.SetRecorder(nil)
+
+	if !gf.Quiet {
+		fmt.Fprintf(os.Stderr, "Recorded %d messages\n", recorder.Count())
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"bambu-cli/internal/printer/sim"
+)
+
+func cmdSimulate(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	bind := fs.String("bind", "127.0.0.1", "address to listen on")
+	serial := fs.String("serial", "SIM00000000001", "simulated printer serial")
+	accessCode := fs.String("access-code", "12345678", "access code clients must use")
+	mqttPort := fs.Int("mqtt-port", 8883, "mqtt port")
+	ftpPort := fs.Int("ftp-port", 9990, "ftps port")
+	cameraPort := fs.Int("camera-port", 6000, "camera port")
+	dir := fs.String("dir", "", "directory served over ftps (default: temporary)")
+	tick := fs.Duration("tick", time.Second, "lifecycle step interval")
+	layers := fs.Int("layers", 20, "layers per simulated print")
+	pauseAt := fs.Int("pause-at-layer", 0, "pause with filament runout at layer")
+	failAt := fs.Int("fail-at-layer", 0, "fail the print at layer")
+	dropAfter := fs.Int64("drop-transfer-after", 0, "cut ftp transfers after this many bytes (to test resuming)")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+
+	s, err := sim.New(sim.Config{
+		Bind:              *bind,
+		Serial:            *serial,
+		AccessCode:        *accessCode,
+		MQTTPort:          *mqttPort,
+		FTPPort:           *ftpPort,
+		CameraPort:        *cameraPort,
+		Dir:               *dir,
+		Tick:              *tick,
+		Layers:            *layers,
+		PauseAtLayer:      *pauseAt,
+		FailAtLayer:       *failAt,
+		DropTransferAfter: *dropAfter,
+	})
+	if err != nil {
+		return errExit(err)
+	}
+	if err := s.Start(); err != nil {
+		return errExit(err)
+	}
+	defer s.Close()
+
+	cfg := s.Config()
+	if !gf.Quiet {
+		fmt.Fprintf(os.Stderr, "Simulator running: %s\n", s)
+		fmt.Fprintln(os.Stderr, "Point a profile at it with:")
+		fmt.Fprintf(os.Stderr, "  printf %%s %s > sim.code\n", cfg.AccessCode)
+		fmt.Fprintf(os.Stderr, "  bambu-cli config set --printer sim --ip %s --serial %s --access-code-file sim.code --mqtt-port %d --ftp-port %d --camera-port %d\n",
+			cfg.Bind, cfg.Serial, cfg.MQTTPort, cfg.FTPPort, cfg.CameraPort)
+		fmt.Fprintln(os.Stderr, "Press Ctrl-C to stop.")
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	return 0
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"bambu-cli/internal/output"
+	"bambu-cli/internal/printer"
+	"bambu-cli/internal/threemf"
+	"bambu-cli/internal/ui"
+)
+
+// skipObject is an object of the running job as listed by print skip.
+type skipObject struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Skipped bool   `json:"skipped"`
+}
+
+func cmdPrintSkip(gf GlobalFlags, args []string) int {
+	fs := flag.NewFlagSet("print skip", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("file", "", "3MF of the running job on the printer (default: from the printer report)")
+	plate := fs.Int("plate", 0, "plate being printed (default: the only sliced plate)")
+	if err := fs.Parse(args); err != nil {
+		return errExit(err)
+	}
+	var ids []int
+	for _, arg := range fs.Args() {
+		list, err := parseIntList(arg)
+		if err != nil {
+			return errExit(err)
+		}
+		for _, id := range list {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	res, err := resolvePrinter(gf, true, true)
+	if err != nil {
+		return errExit(err)
+	}
+	client, err := dialMQTT(res)
+	if err != nil {
+		return errExit(err)
+	}
+	defer client.Close()
+	_ = client.PushAll()
+	_ = client.WaitForData(res.Timeout)
+
+	report := client.Report()
+	state := printer.ParseGcodeState(report.GcodeState)
+	if state != printer.GcodeStateRunning && state != printer.GcodeStatePause {
+		return errExit(fmt.Errorf("no print is running (printer is %s)", state))
+	}
+	jobFile := *file
+	if jobFile == "" {
+		jobFile = report.GcodeFile
+		if !strings.HasSuffix(strings.ToLower(jobFile), ".3mf") {
+			return errExit(fmt.Errorf("cannot tell which 3MF is printing (printer reports %q); pass --file", jobFile))
+		}
+	}
+	proj, err := openRemoteProject(res, jobFile)
+	if err != nil {
+		return errExit(err)
+	}
+	p, err := runningPlate(proj, *plate)
+	if err != nil {
+		return errExit(err)
+	}
+	objects := make([]skipObject, 0, len(p.Objects))
+	for _, o := range p.Objects {
+		objects = append(objects, skipObject{ID: o.ID, Name: o.Name, Skipped: o.Skipped || slices.Contains(report.SkippedObjects, o.ID)})
+	}
+
+	if len(ids) == 0 {
+		return writeSkipObjects(gf, objects)
+	}
+
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		i := slices.IndexFunc(objects, func(o skipObject) bool { return o.ID == id })
+		switch {
+		case i < 0:
+			return errExit(fmt.Errorf("plate %d has no object %d; run print skip without IDs to list them", p.Index, id))
+		case objects[i].Skipped:
+			return errExit(fmt.Errorf("object %d (%s) is already skipped", id, objects[i].Name))
+		}
+		names = append(names, fmt.Sprintf("%d (%s)", id, objects[i].Name))
+	}
+	remaining := 0
+	for _, o := range objects {
+		if !o.Skipped {
+			remaining++
+		}
+	}
+	if len(ids) == remaining {
+		return errExit(errors.New("refusing to skip every remaining object; use print stop instead"))
+	}
+
+	if !gf.Quiet {
+		fmt.Fprintf(os.Stderr, "Objects to skip: %s\n", strings.Join(names, ", "))
+	}
+	if err := ui.RequireConfirmation(ui.ConfirmOptions{
+		Action:  "skip " + joinInts(ids),
+		Force:   gf.Force,
+		Confirm: gf.Confirm,
+		NoInput: gf.NoInput,
+		UseTTY:  ui.IsTerminal(os.Stdin),
+		Out:     os.Stderr,
+	}); err != nil {
+		return errExit(err)
+	}
+	if gf.DryRun {
+		fmt.Fprintf(os.Stdout, "Would skip objects %s\n", joinInts(ids))
+		return 0
+	}
+	return exitOnReply(client.Request(printer.PayloadSkipObjects(ids), res.Timeout))
+}
+
+// runningPlate picks the plate being printed: the one asked for, or the only
+// sliced plate in the project.
+func runningPlate(proj *threemf.Project, index int) (*threemf.Plate, error) {
+	if index != 0 {
+		p, ok := proj.Plate(index)
+		if !ok {
+			return nil, fmt.Errorf("plate %d not found", index)
+		}
+		return p, nil
+	}
+	var sliced []*threemf.Plate
+	for i := range proj.Plates {
+		if proj.Plates[i].Sliced {
+			sliced = append(sliced, &proj.Plates[i])
+		}
+	}
+	switch len(sliced) {
+	case 0:
+		return nil, errors.New("the job's 3MF has no sliced plate")
+	case 1:
+		return sliced[0], nil
+	default:
+		return nil, errors.New("the job's 3MF has several sliced plates; pass --plate")
+	}
+}
+
+func writeSkipObjects(gf GlobalFlags, objects []skipObject) int {
+	switch selectFormat(gf) {
+	case output.JSON:
+		return exitOnErr(output.WriteJSON(os.Stdout, map[string]any{"objects": objects}))
+	case output.Plain:
+		for _, o := range objects {
+			fmt.Fprintf(os.Stdout, "%d\t%s\t%t\n", o.ID, o.Name, o.Skipped)
+		}
+		return 0
+	default:
+		if len(objects) == 0 {
+			fmt.Fprintln(os.Stdout, "The job lists no objects")
+			return 0
+		}
+		for _, o := range objects {
+			line := fmt.Sprintf("%-6d %s", o.ID, o.Name)
+			if o.Skipped {
+				line += " (skipped)"
+			}
+			fmt.Fprintln(os.Stdout, line)
+		}
+		return 0
+	}
+}
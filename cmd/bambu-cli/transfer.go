@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"bambu-cli/internal/output"
+	"bambu-cli/internal/printer"
+	"bambu-cli/internal/ui"
+)
+
+// progressInterval limits how often transfer progress is redrawn or emitted.
+const progressInterval = 250 * time.Millisecond
+
+// showTransferProgress reports the progress of client's transfers of name on
+// stderr: a bar redrawn in place on a terminal, or progress events with
+// --json. Otherwise only retries are mentioned. Call the returned function
+// once the transfer is over.
+func showTransferProgress(gf GlobalFlags, client *printer.FTPClient, op, name string) func() {
+	t := &transferDisplay{
+		gf:    gf,
+		op:    op,
+		name:  name,
+		json:  selectFormat(gf) == output.JSON,
+		tty:   ui.IsTerminal(os.Stderr) && selectFormat(gf) == output.Human && !gf.Quiet,
+		start: time.Now(),
+	}
+	client.SetProgress(t.update)
+	return t.end
+}
+
+type transferDisplay struct {
+	gf       GlobalFlags
+	op       string
+	name     string
+	json     bool
+	tty      bool
+	start    time.Time
+	last     time.Time
+	latest   printer.TransferProgress
+	shown    printer.TransferProgress
+	lineOpen bool
+	unsized  bool
+}
+
+func (t *transferDisplay) update(p printer.TransferProgress) {
+	t.latest = p
+	if p.Retry != nil {
+		t.retry(p)
+		return
+	}
+	if t.op == "download" && p.Total < 0 && !t.unsized {
+		t.unsized = true
+		t.warnUnsized(p)
+	}
+	done := p.Total >= 0 && p.Bytes >= p.Total
+	if !done && time.Since(t.last) < progressInterval {
+		return
+	}
+	t.last = time.Now()
+	t.shown = p
+	switch {
+	case t.json:
+		t.event("progress", p, nil)
+	case t.tty:
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", t.line(p))
+		t.lineOpen = true
+	}
+}
+
+func (t *transferDisplay) retry(p printer.TransferProgress) {
+	if t.json {
+		t.event("retry", p, p.Retry)
+		return
+	}
+	t.endLine()
+	at := ""
+	if p.Bytes > 0 {
+		at = " at " + humanSize(p.Bytes)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s of %s interrupted (%v); resuming%s\n", t.op, t.name, p.Retry, at)
+}
+
+// warnUnsized says a download can't be checked: the printer doesn't report
+// the file's size.
+func (t *transferDisplay) warnUnsized(p printer.TransferProgress) {
+	if t.json {
+		t.event("unverified", p, nil)
+		return
+	}
+	t.endLine()
+	fmt.Fprintf(os.Stderr, "Warning: the printer does not report the size of %s; the download can't be checked or resumed\n", t.name)
+}
+
+// end finishes the progress line. JSON output ends with a final event.
+func (t *transferDisplay) end() {
+	if t.json && t.latest.Bytes != t.shown.Bytes {
+		t.event("progress", t.latest, nil)
+	}
+	t.endLine()
+}
+
+func (t *transferDisplay) endLine() {
+	if t.lineOpen {
+		fmt.Fprintln(os.Stderr)
+		t.lineOpen = false
+	}
+}
+
+func (t *transferDisplay) event(name string, p printer.TransferProgress, err error) {
+	event := map[string]any{"event": name, "op": t.op, "file": t.name, "bytes": p.Bytes}
+	if p.Total >= 0 {
+		event["total"] = p.Total
+	}
+	if err != nil {
+		event["error"] = err.Error()
+	}
+	_ = output.WriteJSON(os.Stderr, event)
+}
+
+// line renders e.g.
+// "Uploading part.3mf [########------------]  42%  63.0 MiB/150.0 MiB  2.1 MiB/s".
+func (t *transferDisplay) line(p printer.TransferProgress) string {
+	const width = 20
+	line := fmt.Sprintf("%s%sing %s ", strings.ToUpper(t.op[:1]), t.op[1:], t.name)
+	if p.Total > 0 {
+		pct := int(p.Bytes * 100 / p.Total)
+		filled := pct * width / 100
+		line += fmt.Sprintf("[%s%s] %3d%%  %s/%s", strings.Repeat("#", filled), strings.Repeat("-", width-filled),
+			pct, humanSize(p.Bytes), humanSize(p.Total))
+	} else {
+		line += humanSize(p.Bytes)
+	}
+	if secs := time.Since(t.start).Seconds(); secs >= 1 {
+		line += fmt.Sprintf("  %s/s", humanSize(int64(float64(p.Bytes)/secs)))
+	}
+	return line
+}
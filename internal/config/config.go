@@ -4,19 +4,28 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
-	"path/filepath"
+
+	"bambu-cli/internal/store"
 )
 
 type Profile struct {
-	IP             string `json:"ip,omitempty"`
-	Serial         string `json:"serial,omitempty"`
-	AccessCodeFile string `json:"access_code_file,omitempty"`
-	Username       string `json:"username,omitempty"`
-	NoCamera       bool   `json:"no_camera,omitempty"`
-	MQTTPort       int    `json:"mqtt_port,omitempty"`
-	FTPPort        int    `json:"ftp_port,omitempty"`
-	CameraPort     int    `json:"camera_port,omitempty"`
-	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	IP                  string `json:"ip,omitempty"`
+	Serial              string `json:"serial,omitempty"`
+	Model               string `json:"model,omitempty"`
+	AccessCodeFile      string `json:"access_code_file,omitempty"`
+	Username            string `json:"username,omitempty"`
+	NoCamera            bool   `json:"no_camera,omitempty"`
+	MQTTPort            int    `json:"mqtt_port,omitempty"`
+	FTPPort             int    `json:"ftp_port,omitempty"`
+	CameraPort          int    `json:"camera_port,omitempty"`
+	TimeoutSeconds      int    `json:"timeout_seconds,omitempty"`
+	ReconnectMaxSeconds int    `json:"reconnect_max_seconds,omitempty"`
+	CertFingerprint     string `json:"cert_fingerprint,omitempty"`
+	CAFile              string `json:"ca_file,omitempty"`
+	BedType             string `json:"bed_type,omitempty"`
+	// QueueAutoConfirm lets queue run start the next job without asking
+	// whether the bed was cleared.
+	QueueAutoConfirm bool `json:"queue_auto_confirm,omitempty"`
 }
 
 type Config struct {
@@ -72,6 +81,9 @@ func mergeProfile(base Profile, override Profile) Profile {
 	if override.Serial != "" {
 		out.Serial = override.Serial
 	}
+	if override.Model != "" {
+		out.Model = override.Model
+	}
 	if override.AccessCodeFile != "" {
 		out.AccessCodeFile = override.AccessCodeFile
 	}
@@ -90,9 +102,24 @@ func mergeProfile(base Profile, override Profile) Profile {
 	if override.TimeoutSeconds != 0 {
 		out.TimeoutSeconds = override.TimeoutSeconds
 	}
+	if override.ReconnectMaxSeconds != 0 {
+		out.ReconnectMaxSeconds = override.ReconnectMaxSeconds
+	}
+	if override.CertFingerprint != "" {
+		out.CertFingerprint = override.CertFingerprint
+	}
+	if override.CAFile != "" {
+		out.CAFile = override.CAFile
+	}
+	if override.BedType != "" {
+		out.BedType = override.BedType
+	}
 	if override.NoCamera {
 		out.NoCamera = true
 	}
+	if override.QueueAutoConfirm {
+		out.QueueAutoConfirm = true
+	}
 	return out
 }
 
@@ -100,13 +127,5 @@ func Save(path string, cfg Config) error {
 	if cfg.Profiles == nil {
 		cfg.Profiles = map[string]Profile{}
 	}
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return err
-	}
-	data, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
-		return err
-	}
-	data = append(data, '\n')
-	return os.WriteFile(path, data, 0o600)
+	return store.Write(path, cfg)
 }
@@ -5,12 +5,22 @@ import (
 	"path/filepath"
 )
 
-func UserConfigPath() (string, error) {
+// UserDir is the directory holding the user config and other bambu-cli data
+// files.
+func UserDir() (string, error) {
 	base, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(base, "bambu", "config.json"), nil
+	return filepath.Join(base, "bambu"), nil
+}
+
+func UserConfigPath() (string, error) {
+	dir, err := UserDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
 }
 
 func ProjectConfigPath(cwd string) string {
@@ -0,0 +1,163 @@
+// Package history stores the print jobs bambu-cli started or watched, in
+// history.json under the user config directory.
+package history
+
+import (
+	"sort"
+	"time"
+
+	"bambu-cli/internal/store"
+)
+
+// Job outcomes. A record is OutcomeRunning until the end of the job is seen;
+// OutcomeUnknown closes a record whose end was never seen.
+const (
+	OutcomeRunning  = "running"
+	OutcomeFinished = "finished"
+	OutcomeFailed   = "failed"
+	OutcomeStopped  = "stopped"
+	OutcomeUnknown  = "unknown"
+)
+
+// Filament is the slicer's estimate for one filament of a job.
+type Filament struct {
+	Type  string  `json:"type"`
+	Color string  `json:"color,omitempty"`
+	Grams float64 `json:"grams"`
+}
+
+// Record is one print job.
+type Record struct {
+	ID        int        `json:"id"`
+	Printer   string     `json:"printer"`
+	File      string     `json:"file"`
+	Plate     int        `json:"plate,omitempty"`
+	Started   time.Time  `json:"started"`
+	Ended     *time.Time `json:"ended,omitempty"`
+	Outcome   string     `json:"outcome"`
+	ErrorCode int        `json:"error_code,omitempty"`
+	Filament  []Filament `json:"filament,omitempty"`
+	// Observed is set for jobs seen by watch rather than started by
+	// bambu-cli; their start time is when they were first seen.
+	Observed bool `json:"observed,omitempty"`
+}
+
+// Duration is how long the job ran, up to now for a running job.
+func (r Record) Duration(now time.Time) time.Duration {
+	if r.Ended != nil {
+		return r.Ended.Sub(r.Started)
+	}
+	return now.Sub(r.Started)
+}
+
+// FilamentGrams is the total filament estimate.
+func (r Record) FilamentGrams() float64 {
+	var g float64
+	for _, f := range r.Filament {
+		g += f.Grams
+	}
+	return g
+}
+
+type History struct {
+	store.Sequence
+	Records []Record `json:"records"`
+}
+
+// Read loads the history; a missing file is an empty history.
+func Read(path string) (History, error) {
+	var h History
+	err := store.Read(path, &h)
+	return h, err
+}
+
+// Save writes the history (see store.Write).
+func Save(path string, h History) error {
+	if h.Records == nil {
+		h.Records = []Record{}
+	}
+	return store.Write(path, h)
+}
+
+// Add appends a record and assigns its ID.
+func (h *History) Add(r Record) Record {
+	r.ID = h.NewID()
+	h.Records = append(h.Records, r)
+	return r
+}
+
+// Open returns the running record for printer, or nil. A printer runs one job
+// at a time, so there is at most one.
+func (h *History) Open(printer string) *Record {
+	for i := len(h.Records) - 1; i >= 0; i-- {
+		r := &h.Records[i]
+		if r.Printer == printer && r.Outcome == OutcomeRunning {
+			return r
+		}
+	}
+	return nil
+}
+
+// Close ends a record.
+func (r *Record) Close(outcome string, errorCode int, at time.Time) {
+	r.Outcome = outcome
+	r.ErrorCode = errorCode
+	r.Ended = &at
+}
+
+// Stats are the aggregates for one printer.
+type Stats struct {
+	Printer  string `json:"printer"`
+	Jobs     int    `json:"jobs"`
+	Finished int    `json:"finished"`
+	Failed   int    `json:"failed"`
+	Stopped  int    `json:"stopped"`
+	// SuccessRate is finished jobs over jobs that finished, failed or were
+	// stopped; 0 when there are none.
+	SuccessRate float64 `json:"success_rate"`
+	// PrintHours is the run time of jobs that finished, failed or were
+	// stopped.
+	PrintHours float64 `json:"print_hours"`
+	// Filament is the estimate of finished jobs in grams, by material.
+	Filament map[string]float64 `json:"filament"`
+}
+
+// Summarize aggregates records per printer, sorted by printer name.
+func Summarize(records []Record) []Stats {
+	byPrinter := map[string]*Stats{}
+	for _, r := range records {
+		s := byPrinter[r.Printer]
+		if s == nil {
+			s = &Stats{Printer: r.Printer, Filament: map[string]float64{}}
+			byPrinter[r.Printer] = s
+		}
+		s.Jobs++
+		switch r.Outcome {
+		case OutcomeFinished:
+			s.Finished++
+			for _, f := range r.Filament {
+				s.Filament[f.Type] += f.Grams
+			}
+		case OutcomeFailed:
+			s.Failed++
+		case OutcomeStopped:
+			s.Stopped++
+		default:
+			// A running job has no end yet, and an unknown one ended at
+			// some point before it was closed.
+			continue
+		}
+		if r.Ended != nil {
+			s.PrintHours += r.Ended.Sub(r.Started).Hours()
+		}
+	}
+	out := make([]Stats, 0, len(byPrinter))
+	for _, s := range byPrinter {
+		if ended := s.Finished + s.Failed + s.Stopped; ended > 0 {
+			s.SuccessRate = float64(s.Finished) / float64(ended)
+		}
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Printer < out[j].Printer })
+	return out
+}
@@ -0,0 +1,43 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	record := func(outcome string, hours float64, grams float64) Record {
+		r := Record{Printer: "lab", Started: start, Outcome: outcome, Filament: []Filament{{Type: "PLA", Grams: grams}}}
+		if outcome != OutcomeRunning {
+			end := start.Add(time.Duration(hours * float64(time.Hour)))
+			r.Ended = &end
+		}
+		return r
+	}
+	stats := Summarize([]Record{
+		record(OutcomeFinished, 2, 30),
+		record(OutcomeFailed, 1, 10),
+		record(OutcomeStopped, 0.5, 5),
+		// An unknown job's end is when the next job started, not when
+		// it stopped printing, so its time is not counted.
+		record(OutcomeUnknown, 48, 20),
+		record(OutcomeRunning, 0, 20),
+	})
+	if len(stats) != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	s := stats[0]
+	if s.Jobs != 5 || s.Finished != 1 || s.Failed != 1 || s.Stopped != 1 {
+		t.Errorf("counts = %+v", s)
+	}
+	if s.PrintHours != 3.5 {
+		t.Errorf("print hours = %v, want 3.5", s.PrintHours)
+	}
+	if s.SuccessRate != 1.0/3 {
+		t.Errorf("success rate = %v", s.SuccessRate)
+	}
+	if s.Filament["PLA"] != 30 {
+		t.Errorf("filament = %v, want only the finished job's 30 g", s.Filament)
+	}
+}
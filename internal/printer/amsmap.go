@@ -0,0 +1,255 @@
+package printer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Special values in a project_file ams_mapping.
+const (
+	TrayExternal = 254 // the external spool holder (vt_tray)
+	TrayUnused   = -1  // a project filament slot the plate does not use
+)
+
+// AMS HT units have a single tray and report unit IDs from amsHTFirst up;
+// ams_mapping refers to their tray by the unit ID itself.
+const (
+	amsHTFirst = 128
+	amsHTLast  = 135
+)
+
+// TrayIndex returns the global tray number ams_mapping uses for a tray of
+// an AMS unit: unit * 4 + tray for a four-tray AMS, the unit ID for an AMS
+// HT.
+func TrayIndex(unit, tray int) int {
+	if isAMSHT(unit) {
+		return unit
+	}
+	return unit*4 + tray
+}
+
+func isAMSHT(index int) bool {
+	return index >= amsHTFirst && index <= amsHTLast
+}
+
+// FilamentRequest is a filament a job needs: its 1-based slot in the
+// project's filament list, material type and colour ("#RRGGBB").
+type FilamentRequest struct {
+	Slot  int
+	Type  string
+	Color string
+}
+
+// LoadedTray is a tray with filament loaded. Index is the global tray number
+// used in ams_mapping (see TrayIndex), or TrayExternal.
+type LoadedTray struct {
+	Index  int
+	Type   string
+	Color  string
+	Remain int // percent, -1 when unknown
+	Weight int // spool weight in grams, 0 when unknown
+}
+
+// RemainingGrams estimates the filament left on the spool. ok is false when
+// the printer does not know.
+func (t LoadedTray) RemainingGrams() (grams float64, ok bool) {
+	if t.Remain < 0 || t.Weight <= 0 {
+		return 0, false
+	}
+	return float64(t.Remain) * float64(t.Weight) / 100, true
+}
+
+// Label names the tray the way the printer's screen does, e.g. "AMS A2",
+// "HT-A" or "External".
+func (t LoadedTray) Label() string {
+	switch {
+	case t.Index == TrayExternal:
+		return "External"
+	case isAMSHT(t.Index):
+		return fmt.Sprintf("HT-%c", 'A'+rune(t.Index-amsHTFirst))
+	}
+	return fmt.Sprintf("AMS %c%d", 'A'+rune(t.Index/4), t.Index%4+1)
+}
+
+// TrayChoice is the tray picked for one filament slot.
+type TrayChoice struct {
+	Request FilamentRequest
+	Tray    LoadedTray
+	// Distance is the colour difference between request and tray; 0 is an
+	// exact match.
+	Distance float64
+	// TypeMismatch is set when no tray with the requested material is
+	// loaded and a tray of another material was chosen.
+	TypeMismatch bool
+}
+
+// AMSMapping is the result of MapFilaments.
+type AMSMapping struct {
+	// Mapping is indexed by project filament slot - 1 and holds the global
+	// tray index, or TrayUnused for slots the plate does not use.
+	Mapping []int
+	Choices []TrayChoice
+	// Missing lists requests for which no tray of the material is loaded.
+	Missing []FilamentRequest
+}
+
+// LoadedTrays lists the trays that have filament in them.
+func LoadedTrays(ams *AMSReport, external *AMSTray) []LoadedTray {
+	var trays []LoadedTray
+	if ams != nil {
+		for _, unit := range ams.Units {
+			unitID, err := strconv.Atoi(unit.ID)
+			if err != nil {
+				continue
+			}
+			for _, tr := range unit.Trays {
+				trayID, err := strconv.Atoi(tr.ID)
+				if err != nil || tr.TrayType == "" {
+					continue
+				}
+				trays = append(trays, loadedTray(TrayIndex(unitID, trayID), tr))
+			}
+		}
+	}
+	if external != nil && external.TrayType != "" {
+		trays = append(trays, loadedTray(TrayExternal, *external))
+	}
+	return trays
+}
+
+func loadedTray(index int, tr AMSTray) LoadedTray {
+	weight, _ := strconv.Atoi(tr.TrayWeight)
+	return LoadedTray{Index: index, Type: tr.TrayType, Color: tr.TrayColor, Remain: tr.Remain, Weight: weight}
+}
+
+// MapFilaments assigns a loaded tray to each requested filament. Trays with
+// the same material are matched by nearest colour, preferring a distinct
+// tray per slot. Requests whose material is not loaded are listed in
+// Missing and, if any tray is loaded, mapped to the nearest colour of any
+// material with TypeMismatch set.
+func MapFilaments(reqs []FilamentRequest, trays []LoadedTray) AMSMapping {
+	type pair struct {
+		req, tray int
+		dist      float64
+	}
+	var pairs []pair
+	for i, r := range reqs {
+		for j, t := range trays {
+			if strings.EqualFold(strings.TrimSpace(r.Type), strings.TrimSpace(t.Type)) {
+				pairs = append(pairs, pair{i, j, colorDistance(r.Color, t.Color)})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].dist < pairs[b].dist })
+
+	chosen := make([]int, len(reqs))
+	dist := make([]float64, len(reqs))
+	for i := range chosen {
+		chosen[i] = -1
+	}
+	used := map[int]bool{}
+	// First pass gives each slot its own tray; the second lets slots share
+	// a tray when there are more slots than matching trays.
+	for pass := 0; pass < 2; pass++ {
+		for _, p := range pairs {
+			if chosen[p.req] >= 0 || (pass == 0 && used[p.tray]) {
+				continue
+			}
+			chosen[p.req], dist[p.req] = p.tray, p.dist
+			used[p.tray] = true
+		}
+	}
+
+	var out AMSMapping
+	maxSlot := 0
+	for _, r := range reqs {
+		if r.Slot > maxSlot {
+			maxSlot = r.Slot
+		}
+	}
+	out.Mapping = make([]int, maxSlot)
+	for i := range out.Mapping {
+		out.Mapping[i] = TrayUnused
+	}
+	for i, r := range reqs {
+		choice := TrayChoice{Request: r}
+		if chosen[i] < 0 {
+			out.Missing = append(out.Missing, r)
+			best := -1
+			for j, t := range trays {
+				d := colorDistance(r.Color, t.Color)
+				if best < 0 || d < choice.Distance {
+					best, choice.Distance = j, d
+				}
+			}
+			if best < 0 {
+				continue
+			}
+			chosen[i] = best
+			choice.TypeMismatch = true
+		} else {
+			choice.Distance = dist[i]
+		}
+		choice.Tray = trays[chosen[i]]
+		if r.Slot > 0 {
+			out.Mapping[r.Slot-1] = choice.Tray.Index
+		}
+		out.Choices = append(out.Choices, choice)
+	}
+	return out
+}
+
+// colorDistance compares two colours given as "#RRGGBB" or "RRGGBBAA" using
+// the weighted "redmean" approximation of perceived difference. Unparseable
+// colours are maximally distant.
+func colorDistance(a, b string) float64 {
+	ra, ga, ba, okA := parseColor(a)
+	rb, gb, bb, okB := parseColor(b)
+	if !okA || !okB {
+		return math.MaxFloat64
+	}
+	rmean := (ra + rb) / 2
+	dr, dg, db := ra-rb, ga-gb, ba-bb
+	return math.Sqrt((2+rmean/256)*dr*dr + 4*dg*dg + (2+(255-rmean)/256)*db*db)
+}
+
+func parseColor(s string) (r, g, b float64, ok bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 && len(s) != 8 {
+		return 0, 0, 0, false
+	}
+	v, err := strconv.ParseUint(s[:6], 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return float64(v >> 16 & 0xFF), float64(v >> 8 & 0xFF), float64(v & 0xFF), true
+}
+
+// MappingFromIndices describes an explicit ams_mapping (as given with
+// --ams-mapping) in the same terms as MapFilaments, so it can be checked
+// against the loaded trays.
+func MappingFromIndices(reqs []FilamentRequest, trays []LoadedTray, mapping []int) AMSMapping {
+	out := AMSMapping{Mapping: mapping}
+	byIndex := map[int]LoadedTray{}
+	for _, t := range trays {
+		byIndex[t.Index] = t
+	}
+	for _, r := range reqs {
+		if r.Slot < 1 || r.Slot > len(mapping) {
+			out.Missing = append(out.Missing, r)
+			continue
+		}
+		tray, ok := byIndex[mapping[r.Slot-1]]
+		if !ok {
+			out.Missing = append(out.Missing, r)
+			continue
+		}
+		choice := TrayChoice{Request: r, Tray: tray, Distance: colorDistance(r.Color, tray.Color)}
+		choice.TypeMismatch = !strings.EqualFold(strings.TrimSpace(r.Type), strings.TrimSpace(tray.Type))
+		out.Choices = append(out.Choices, choice)
+	}
+	return out
+}
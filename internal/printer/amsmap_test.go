@@ -0,0 +1,34 @@
+package printer
+
+import "testing"
+
+func TestLoadedTrays(t *testing.T) {
+	ams := &AMSReport{Units: []AMSUnit{
+		{ID: "0", Trays: []AMSTray{{ID: "0", TrayType: "PLA"}, {ID: "1"}, {ID: "2", TrayType: "PETG"}}},
+		{ID: "1", Trays: []AMSTray{{ID: "3", TrayType: "ABS"}}},
+		{ID: "128", Trays: []AMSTray{{ID: "0", TrayType: "PA"}}},
+		{ID: "129", Trays: []AMSTray{{ID: "0", TrayType: "TPU"}}},
+	}}
+	external := &AMSTray{ID: "254", TrayType: "PLA"}
+
+	want := []struct {
+		index int
+		label string
+	}{
+		{0, "AMS A1"},
+		{2, "AMS A3"},
+		{7, "AMS B4"},
+		{128, "HT-A"},
+		{129, "HT-B"},
+		{TrayExternal, "External"},
+	}
+	trays := LoadedTrays(ams, external)
+	if len(trays) != len(want) {
+		t.Fatalf("LoadedTrays = %+v", trays)
+	}
+	for i, w := range want {
+		if trays[i].Index != w.index || trays[i].Label() != w.label {
+			t.Errorf("tray %d = %d %q, want %d %q", i, trays[i].Index, trays[i].Label(), w.index, w.label)
+		}
+	}
+}
@@ -18,7 +18,7 @@ type CameraClient struct {
 	tlsConfig *tls.Config
 }
 
-func NewCameraClient(ip, accessCode, username string, port int, timeout time.Duration) *CameraClient {
+func NewCameraClient(ip, accessCode, username string, port int, timeout time.Duration, tlsConfig *tls.Config) *CameraClient {
 	if username == "" {
 		username = "bblp"
 	}
@@ -28,12 +28,15 @@ func NewCameraClient(ip, accessCode, username string, port int, timeout time.Dur
 	if timeout <= 0 {
 		timeout = 10 * time.Second
 	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
 	return &CameraClient{
 		addr:      fmt.Sprintf("%s:%d", ip, port),
 		username:  username,
 		access:    accessCode,
 		timeout:   timeout,
-		tlsConfig: &tls.Config{InsecureSkipVerify: true},
+		tlsConfig: tlsConfig,
 	}
 }
 
@@ -0,0 +1,189 @@
+package printer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Condition is a parsed watch expression such as "state=FINISH",
+// "state in (FINISH,FAILED)" or "layer>=20".
+type Condition struct {
+	Field  string
+	Op     string
+	Values []string
+}
+
+var conditionOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+var conditionFields = map[string]bool{
+	"state":        true,
+	"stage":        true,
+	"percent":      true,
+	"layer":        true,
+	"layer_total":  true,
+	"remaining":    true,
+	"bed_temp":     true,
+	"nozzle_temp":  true,
+	"chamber_temp": true,
+	"error_code":   true,
+}
+
+func ParseCondition(expr string) (Condition, error) {
+	expr = strings.TrimSpace(expr)
+	lower := strings.ToLower(expr)
+	if i := strings.Index(lower, " in "); i > 0 {
+		field := strings.ToLower(strings.TrimSpace(expr[:i]))
+		list := strings.TrimSpace(expr[i+4:])
+		if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+			return Condition{}, fmt.Errorf("invalid condition %q: expected list in parentheses", expr)
+		}
+		var values []string
+		for _, v := range strings.Split(list[1:len(list)-1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return Condition{}, fmt.Errorf("invalid condition %q: empty list", expr)
+		}
+		return newCondition(expr, field, "in", values)
+	}
+	for _, op := range conditionOps {
+		if i := strings.Index(expr, op); i > 0 {
+			field := strings.ToLower(strings.TrimSpace(expr[:i]))
+			value := strings.TrimSpace(expr[i+len(op):])
+			if value == "" {
+				return Condition{}, fmt.Errorf("invalid condition %q: missing value", expr)
+			}
+			return newCondition(expr, field, op, []string{value})
+		}
+	}
+	return Condition{}, fmt.Errorf("invalid condition %q", expr)
+}
+
+func newCondition(expr, field, op string, values []string) (Condition, error) {
+	if !conditionFields[field] {
+		return Condition{}, fmt.Errorf("invalid condition %q: unknown field %s", expr, field)
+	}
+	if !isTextField(field) {
+		for _, v := range values {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return Condition{}, fmt.Errorf("invalid condition %q: %s is not a number", expr, v)
+			}
+		}
+	} else if op != "=" && op != "!=" && op != "in" {
+		return Condition{}, fmt.Errorf("invalid condition %q: %s only supports =, != and in", expr, field)
+	} else {
+		names := conditionNames(field)
+		for _, v := range values {
+			if !names[strings.ToUpper(v)] {
+				return Condition{}, fmt.Errorf("invalid condition %q: unknown %s %s", expr, field, v)
+			}
+		}
+	}
+	return Condition{Field: field, Op: op, Values: values}, nil
+}
+
+// conditionNames returns the values a state or stage can take.
+func conditionNames(field string) map[string]bool {
+	names := map[string]bool{string(GcodeStateUnknown): true}
+	if field == "stage" {
+		names[PrintStatusIdle.String()] = true
+		for _, name := range printStatusNames {
+			names[name] = true
+		}
+		return names
+	}
+	for _, state := range []GcodeState{GcodeStateIdle, GcodeStatePrepare, GcodeStateRunning, GcodeStatePause, GcodeStateFinish, GcodeStateFailed} {
+		names[string(state)] = true
+	}
+	return names
+}
+
+func isTextField(field string) bool {
+	return field == "state" || field == "stage"
+}
+
+// Match evaluates the condition against a status.
+func (c Condition) Match(s Status) bool {
+	if isTextField(c.Field) {
+		actual := string(s.GcodeState)
+		if c.Field == "stage" {
+			actual = s.PrintStatus
+		}
+		switch c.Op {
+		case "!=":
+			return !strings.EqualFold(actual, c.Values[0])
+		default:
+			for _, v := range c.Values {
+				if strings.EqualFold(actual, v) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	actual, ok := numericField(s, c.Field)
+	if !ok {
+		return false
+	}
+	for _, raw := range c.Values {
+		want, _ := strconv.ParseFloat(raw, 64)
+		if compare(actual, c.Op, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Condition) String() string {
+	if c.Op == "in" {
+		return fmt.Sprintf("%s in (%s)", c.Field, strings.Join(c.Values, ","))
+	}
+	return c.Field + c.Op + c.Values[0]
+}
+
+func numericField(s Status, field string) (float64, bool) {
+	switch field {
+	case "percent":
+		return float64(s.Percent), true
+	case "layer":
+		return float64(s.LayerCurrent), true
+	case "layer_total":
+		return float64(s.LayerTotal), true
+	case "remaining":
+		if s.RemainingMinutes == nil {
+			return 0, false
+		}
+		return float64(*s.RemainingMinutes), true
+	case "bed_temp":
+		return s.BedTemp, true
+	case "nozzle_temp":
+		return s.NozzleTemp, true
+	case "chamber_temp":
+		return s.ChamberTemp, true
+	case "error_code":
+		return float64(s.ErrorCode), true
+	default:
+		return 0, false
+	}
+}
+
+func compare(a float64, op string, b float64) bool {
+	switch op {
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case "!=":
+		return a != b
+	default:
+		return a == b
+	}
+}
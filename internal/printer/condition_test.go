@@ -0,0 +1,27 @@
+package printer
+
+import "testing"
+
+func TestParseConditionValidatesNames(t *testing.T) {
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{"state=FINISH", true},
+		{"state=finish", true},
+		{"state in (FINISH,FAILED)", true},
+		{"state=FINSIH", false},
+		{"state in (FINISH,DONE)", false},
+		{"stage=PAUSED_FILAMENT_RUNOUT", true},
+		{"stage!=idle", true},
+		{"stage=PRINTNG", false},
+		{"layer>=20", true},
+		{"layer>=twenty", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseCondition(tt.expr)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseCondition(%q) error = %v, want ok %v", tt.expr, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package printer
+
+import "time"
+
+// ConnState is the state of the client's link to the printer.
+type ConnState string
+
+const (
+	ConnConnected    ConnState = "connected"
+	ConnReconnecting ConnState = "reconnecting"
+	ConnDisconnected ConnState = "disconnected"
+)
+
+// Connection describes the client's link to the printer. LastMessage is the
+// time the most recent report arrived; while the state is not connected the
+// cached report is stale from that point.
+type Connection struct {
+	State       ConnState `json:"state"`
+	Since       time.Time `json:"since"`
+	LastMessage time.Time `json:"last_message"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// MessageAge returns how long ago the last report arrived, or 0 if none has.
+func (c Connection) MessageAge(now time.Time) time.Duration {
+	if c.LastMessage.IsZero() {
+		return 0
+	}
+	return now.Sub(c.LastMessage)
+}
+
+// Connection returns the current connection state.
+func (m *MQTTClient) Connection() Connection {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	return m.conn
+}
+
+// setConnState records a state change and reports the previous state.
+func (m *MQTTClient) setConnState(state ConnState, errMsg string) ConnState {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	prev := m.conn.State
+	if prev != state {
+		m.conn.Since = time.Now()
+	}
+	m.conn.State = state
+	m.conn.Error = errMsg
+	return prev
+}
+
+func (m *MQTTClient) touch(t time.Time) {
+	m.connMu.Lock()
+	m.conn.LastMessage = t
+	m.connMu.Unlock()
+}
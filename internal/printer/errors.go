@@ -0,0 +1,106 @@
+package printer
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed data/print_errors.json
+var printErrorsJSON []byte
+
+// PrintError is a print_error code resolved against the error catalog.
+type PrintError struct {
+	Code        int    `json:"code"`
+	Hex         string `json:"hex"`
+	Description string `json:"description,omitempty"`
+	Action      string `json:"action,omitempty"`
+}
+
+type errorCatalog struct {
+	Version string `json:"version"`
+	Errors  map[string]struct {
+		Description string `json:"description"`
+		Action      string `json:"action"`
+	} `json:"errors"`
+}
+
+var printErrors = mustLoadErrorCatalog(printErrorsJSON)
+
+func mustLoadErrorCatalog(data []byte) errorCatalog {
+	var c errorCatalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		panic(fmt.Sprintf("invalid embedded error catalog: %v", err))
+	}
+	return c
+}
+
+// PrintErrorCancelled is the print_error a printer reports after the job was
+// stopped by the user.
+const PrintErrorCancelled = 0x0300400C
+
+// FormatPrintError renders a print_error value the way Bambu documents it,
+// e.g. 50348044 becomes "0300-400C".
+func FormatPrintError(code int) string {
+	u := uint32(code)
+	return fmt.Sprintf("%04X-%04X", u>>16, u&0xFFFF)
+}
+
+// LookupPrintError resolves a print_error value against the catalog. AMS
+// errors are stored once, for AMS A, and expanded for the unit in the code.
+func LookupPrintError(code int) PrintError {
+	pe := PrintError{Code: code, Hex: FormatPrintError(code)}
+	key, unit := pe.Hex, ""
+	if u := uint32(code); u>>24 == hmsModuleAMS && (u>>16)&0xFF < 4 {
+		key = FormatPrintError(int(u &^ 0x00FF0000))
+		unit = string(rune('A' + (u>>16)&0xFF))
+	}
+	if entry, ok := printErrors.Errors[key]; ok {
+		pe.Description = strings.ReplaceAll(entry.Description, "{ams}", unit)
+		pe.Action = strings.ReplaceAll(entry.Action, "{ams}", unit)
+	}
+	return pe
+}
+
+// CatalogVersions returns the versions of the HMS table and the print error
+// catalog in use.
+func CatalogVersions() (hms string, printErr string) {
+	return hmsCodes.Version, printErrors.Version
+}
+
+// LoadCatalogs replaces the embedded HMS table and print error catalog with
+// hms_codes.json and print_errors.json from dir when those files exist, so
+// the data can be refreshed without a new release.
+func LoadCatalogs(dir string) error {
+	if data, err := readCatalog(dir, "hms_codes.json"); err != nil {
+		return err
+	} else if data != nil {
+		var t hmsTable
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("hms_codes.json: %w", err)
+		}
+		hmsCodes = t
+	}
+	if data, err := readCatalog(dir, "print_errors.json"); err != nil {
+		return err
+	} else if data != nil {
+		var c errorCatalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("print_errors.json: %w", err)
+		}
+		printErrors = c
+	}
+	return nil
+}
+
+func readCatalog(dir, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
@@ -0,0 +1,23 @@
+package printer
+
+import "testing"
+
+func TestLookupPrintError(t *testing.T) {
+	tests := []struct {
+		code int
+		hex  string
+		desc string
+	}{
+		{0x0300400C, "0300-400C", "The print was cancelled."},
+		{0x07008011, "0700-8011", "AMS A filament has run out."},
+		{0x07028011, "0702-8011", "AMS C filament has run out."},
+		{0x07FF8011, "07FF-8011", "External spool filament has run out."},
+		{0x0300FFFF, "0300-FFFF", ""},
+	}
+	for _, tt := range tests {
+		pe := LookupPrintError(tt.code)
+		if pe.Hex != tt.hex || pe.Description != tt.desc {
+			t.Errorf("LookupPrintError(%#x) = %+v", tt.code, pe)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package printer
+
+import (
+	"math"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventStateChanged       EventType = "state_changed"
+	EventLayerChanged       EventType = "layer_changed"
+	EventTempChanged        EventType = "temp_changed"
+	EventHMSRaised          EventType = "hms_raised"
+	EventHMSCleared         EventType = "hms_cleared"
+	EventConnectionLost     EventType = "connection_lost"
+	EventConnectionRestored EventType = "connection_restored"
+)
+
+// Event describes a change observed on the printer. Only the fields relevant
+// to Type are set.
+type Event struct {
+	Type      EventType  `json:"type"`
+	Time      time.Time  `json:"time"`
+	State     GcodeState `json:"state,omitempty"`
+	PrevState GcodeState `json:"prev_state,omitempty"`
+	Layer     int        `json:"layer,omitempty"`
+	PrevLayer int        `json:"prev_layer,omitempty"`
+	Sensor    string     `json:"sensor,omitempty"`
+	Temp      float64    `json:"temp,omitempty"`
+	PrevTemp  float64    `json:"prev_temp,omitempty"`
+	HMS       *HMSEntry  `json:"hms,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Subscribe registers for change events. Events are dropped rather than
+// blocking the MQTT handler when the buffer is full. The returned function
+// unsubscribes and closes the channel.
+func (m *MQTTClient) Subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = 16
+	}
+	ch := make(chan Event, buffer)
+	m.subsMu.Lock()
+	id := m.nextSub
+	m.nextSub++
+	m.subs[id] = ch
+	m.subsMu.Unlock()
+	return ch, func() {
+		m.subsMu.Lock()
+		defer m.subsMu.Unlock()
+		if _, ok := m.subs[id]; ok {
+			delete(m.subs, id)
+			close(ch)
+		}
+	}
+}
+
+func (m *MQTTClient) hasSubscribers() bool {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	return len(m.subs) > 0
+}
+
+func (m *MQTTClient) emit(events ...Event) {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	for _, ev := range events {
+		for _, ch := range m.subs {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+}
+
+// DiffReports returns the events implied by moving from prev to next.
+// Temperatures are compared in whole degrees to avoid reporting sensor noise.
+func DiffReports(prev, next PrintReport, now time.Time) []Event {
+	var events []Event
+	if next.GcodeState != "" && next.GcodeState != prev.GcodeState {
+		events = append(events, Event{
+			Type:      EventStateChanged,
+			Time:      now,
+			State:     ParseGcodeState(next.GcodeState),
+			PrevState: ParseGcodeState(prev.GcodeState),
+		})
+	}
+	if next.LayerNum != prev.LayerNum {
+		events = append(events, Event{Type: EventLayerChanged, Time: now, Layer: next.LayerNum, PrevLayer: prev.LayerNum})
+	}
+	temps := []struct {
+		sensor     string
+		prev, next float64
+	}{
+		{"bed", prev.BedTemper, next.BedTemper},
+		{"nozzle", prev.NozzleTemper, next.NozzleTemper},
+		{"chamber", prev.ChamberTemp(), next.ChamberTemp()},
+	}
+	for _, t := range temps {
+		if math.Round(t.prev) != math.Round(t.next) {
+			events = append(events, Event{Type: EventTempChanged, Time: now, Sensor: t.sensor, Temp: t.next, PrevTemp: t.prev})
+		}
+	}
+	for _, e := range hmsDifference(next.HMS, prev.HMS) {
+		e := e
+		events = append(events, Event{Type: EventHMSRaised, Time: now, HMS: &e})
+	}
+	for _, e := range hmsDifference(prev.HMS, next.HMS) {
+		e := e
+		events = append(events, Event{Type: EventHMSCleared, Time: now, HMS: &e})
+	}
+	return events
+}
+
+// hmsDifference returns the entries of a that are not in b.
+func hmsDifference(a, b []HMSEntry) []HMSEntry {
+	seen := make(map[HMSEntry]bool, len(b))
+	for _, e := range b {
+		seen[e] = true
+	}
+	var out []HMSEntry
+	for _, e := range a {
+		if !seen[e] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -2,23 +2,49 @@ package printer
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net"
+	"net/textproto"
 	"os"
+	"path"
 	"time"
 
 	"github.com/jlaffaye/ftp"
 )
 
+// ftpAttempts is how many times a transfer is tried before giving up. Each
+// retry resumes where the last attempt stopped.
+const ftpAttempts = 4
+
+// partSuffix marks a transfer in progress. The file is renamed once
+// complete, so a failed transfer never leaves a truncated file under the
+// real name.
+const partSuffix = ".part"
+
 type FTPClient struct {
 	addr      string
 	user      string
 	pass      string
 	timeout   time.Duration
 	tlsConfig *tls.Config
+	progress  func(TransferProgress)
 }
 
-func NewFTPClient(ip, accessCode, username string, port int, timeout time.Duration) *FTPClient {
+// TransferProgress is reported as an upload or download goes along.
+type TransferProgress struct {
+	Bytes int64
+	// Total is the file size, or -1 when the printer doesn't report it; a
+	// download is then neither checked nor resumed.
+	Total int64
+	// Retry is the error that ended the last attempt when the transfer is
+	// resuming from Bytes.
+	Retry error
+}
+
+func NewFTPClient(ip, accessCode, username string, port int, timeout time.Duration, tlsConfig *tls.Config) *FTPClient {
 	if username == "" {
 		username = "bblp"
 	}
@@ -28,71 +54,428 @@ func NewFTPClient(ip, accessCode, username string, port int, timeout time.Durati
 	if timeout <= 0 {
 		timeout = 10 * time.Second
 	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
 	return &FTPClient{
 		addr:      fmt.Sprintf("%s:%d", ip, port),
 		user:      username,
 		pass:      accessCode,
 		timeout:   timeout,
-		tlsConfig: &tls.Config{InsecureSkipVerify: true},
+		tlsConfig: tlsConfig,
+	}
+}
+
+// SetProgress sets a function called as uploads and downloads progress.
+func (c *FTPClient) SetProgress(fn func(TransferProgress)) {
+	c.progress = fn
+}
+
+func (c *FTPClient) report(p TransferProgress) {
+	if c.progress != nil {
+		c.progress(p)
+	}
+}
+
+func (c *FTPClient) dial() (*ftp.ServerConn, error) {
+	// Every connection, control and data, gives up after a stretch without
+	// progress, so a transfer over a dead link fails and can be retried
+	// rather than hang.
+	idle := max(c.timeout, 30*time.Second)
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := ftp.Dial(c.addr, ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+		raw, err := dialer.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return tls.Client(&idleConn{Conn: raw, timeout: idle}, c.tlsConfig), nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Login(c.user, c.pass); err != nil {
+		_ = conn.Quit()
+		return nil, err
 	}
+	return conn, nil
 }
 
 func (c *FTPClient) withConn(fn func(*ftp.ServerConn) error) error {
-	conn, err := ftp.Dial(c.addr, ftp.DialWithTimeout(c.timeout), ftp.DialWithTLS(c.tlsConfig))
+	conn, err := c.dial()
 	if err != nil {
 		return err
 	}
 	defer conn.Quit()
-	if err := conn.Login(c.user, c.pass); err != nil {
+	return fn(conn)
+}
+
+// withRetries runs fn on a fresh connection until it succeeds, fails in a
+// way a retry won't fix or runs out of attempts. fn gets the error that ended
+// the previous attempt, nil on the first. A printer that can't be reached at
+// all isn't retried.
+func (c *FTPClient) withRetries(fn func(conn *ftp.ServerConn, prev error) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		prev := err
+		conn, dialErr := c.dial()
+		if dialErr != nil {
+			if attempt == 1 || !retryable(dialErr) {
+				return dialErr
+			}
+			err = dialErr
+		} else {
+			err = briefError(fn(conn, prev))
+			_ = conn.Quit()
+			if err == nil || !retryable(err) {
+				return err
+			}
+		}
+		if attempt == ftpAttempts {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+// retryable tells transient failures, such as a dropped connection, from
+// those a retry won't fix: permanent FTP replies (no such file, no space,
+// bad login), local file errors and transfers that can't be resumed.
+func retryable(err error) bool {
+	if errors.As(err, new(noResumeError)) {
+		return false
+	}
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code < 500
+	}
+	var pathErr *fs.PathError
+	return !errors.As(err, &pathErr)
+}
+
+// briefError reduces the several errors the FTP library collects when a
+// transfer breaks to the most telling one: the server's reply if there is
+// one, otherwise the first.
+func briefError(err error) error {
+	if errors.As(err, new(noResumeError)) {
 		return err
 	}
-	return fn(conn)
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply
+	}
+	if multi, ok := err.(interface{ WrappedErrors() []error }); ok && len(multi.WrappedErrors()) > 0 {
+		return multi.WrappedErrors()[0]
+	}
+	return err
 }
 
-func (c *FTPClient) List(path string) ([]string, error) {
-	var entries []string
+// idleConn fails a read or write that makes no progress within timeout.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c *idleConn) Write(p []byte) (int, error) {
+	_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
+
+// countingReader counts the bytes read through it into n and reports them.
+type countingReader struct {
+	r      io.Reader
+	n      *int64
+	total  int64
+	report func(TransferProgress)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		*r.n += int64(n)
+		r.report(TransferProgress{Bytes: *r.n, Total: r.total})
+	}
+	return n, err
+}
+
+// Remote file types.
+const (
+	FileTypeFile = "file"
+	FileTypeDir  = "dir"
+	FileTypeLink = "link"
+)
+
+// RemoteFile is an entry of a directory listing on the printer.
+type RemoteFile struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Type    string    `json:"type"`
+}
+
+// List returns the entries of dir.
+func (c *FTPClient) List(dir string) ([]RemoteFile, error) {
+	var entries []RemoteFile
+	err := c.withConn(func(conn *ftp.ServerConn) error {
+		var err error
+		entries, err = listDir(conn, dir, false)
+		return err
+	})
+	return entries, err
+}
+
+// ListRecursive returns the entries of dir and of every directory below it.
+// Each directory comes before its contents.
+func (c *FTPClient) ListRecursive(dir string) ([]RemoteFile, error) {
+	var entries []RemoteFile
 	err := c.withConn(func(conn *ftp.ServerConn) error {
-		list, err := conn.List(path)
+		var err error
+		entries, err = listDir(conn, dir, true)
+		return err
+	})
+	return entries, err
+}
+
+func listDir(conn *ftp.ServerConn, dir string, recursive bool) ([]RemoteFile, error) {
+	list, err := conn.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []RemoteFile
+	for _, e := range list {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		f := RemoteFile{
+			Name:    e.Name,
+			Path:    path.Join(dir, e.Name),
+			Size:    int64(e.Size),
+			ModTime: e.Time,
+			Type:    FileTypeFile,
+		}
+		switch e.Type {
+		case ftp.EntryTypeFolder:
+			f.Type, f.Size = FileTypeDir, 0
+		case ftp.EntryTypeLink:
+			f.Type = FileTypeLink
+		}
+		entries = append(entries, f)
+		if recursive && f.Type == FileTypeDir {
+			sub, err := listDir(conn, f.Path, true)
+			if err != nil {
+				return nil, fmt.Errorf("listing %s: %w", f.Path, err)
+			}
+			entries = append(entries, sub...)
+		}
+	}
+	return entries, nil
+}
+
+// Upload stores a local file on the printer. The data goes to a ".part" file
+// that is renamed to remotePath once its size on the printer matches the
+// local file. An interrupted upload resumes from what the printer already
+// has; if it can't be completed the partial file is removed.
+func (c *FTPClient) Upload(localPath, remotePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	part := remotePath + partSuffix
+
+	err = c.withRetries(func(conn *ftp.ServerConn, prev error) error {
+		var offset int64
+		if prev != nil {
+			// Resume after what arrived; a part file that doesn't fit is
+			// rewritten from the start.
+			if have, err := conn.FileSize(part); err == nil && have <= size {
+				offset = have
+			}
+			c.report(TransferProgress{Bytes: offset, Total: size, Retry: prev})
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		sent := offset
+		r := &countingReader{r: f, n: &sent, total: size, report: c.report}
+		if err := conn.StorFrom(part, r, uint64(offset)); err != nil {
+			return err
+		}
+		have, err := conn.FileSize(part)
 		if err != nil {
 			return err
 		}
-		for _, e := range list {
-			entries = append(entries, e.Name)
+		if have != size {
+			return fmt.Errorf("upload incomplete: printer has %d of %d bytes", have, size)
+		}
+		if err := conn.Rename(part, remotePath); err != nil {
+			// Not every server renames over an existing file.
+			if conn.Delete(remotePath) != nil {
+				return err
+			}
+			return conn.Rename(part, remotePath)
 		}
 		return nil
 	})
-	return entries, err
+	if err != nil {
+		c.removePart(part)
+	}
+	return err
 }
 
-func (c *FTPClient) Upload(localPath, remotePath string) error {
-	return c.withConn(func(conn *ftp.ServerConn) error {
-		f, err := os.Open(localPath)
-		if err != nil {
+// UploadReader stores the contents of r on the printer through a ".part"
+// file like Upload. A reader can't be rewound, so a failed upload is not
+// retried.
+func (c *FTPClient) UploadReader(r io.Reader, remotePath string) error {
+	part := remotePath + partSuffix
+	err := c.withConn(func(conn *ftp.ServerConn) error {
+		var sent int64
+		if err := conn.Stor(part, &countingReader{r: r, n: &sent, total: -1, report: c.report}); err != nil {
 			return err
 		}
-		defer f.Close()
-		return conn.Stor(remotePath, f)
+		return conn.Rename(part, remotePath)
 	})
+	if err != nil {
+		c.removePart(part)
+	}
+	return err
 }
 
-func (c *FTPClient) UploadReader(r io.Reader, remotePath string) error {
-	return c.withConn(func(conn *ftp.ServerConn) error {
-		return conn.Stor(remotePath, r)
+// removePart deletes what a failed upload left behind, if the printer can
+// still be reached.
+func (c *FTPClient) removePart(part string) {
+	_ = c.withConn(func(conn *ftp.ServerConn) error {
+		return conn.Delete(part)
 	})
 }
 
+// Download writes a remote file to w. An interrupted download resumes from
+// the bytes already written, and the total is checked against the size the
+// printer reports. If the printer doesn't report the size, the file is
+// downloaded once, unchecked, and progress shows a Total of -1.
 func (c *FTPClient) Download(remotePath string, w io.Writer) error {
-	return c.withConn(func(conn *ftp.ServerConn) error {
-		r, err := conn.Retr(remotePath)
+	return c.retrieve(remotePath, w, 0, nil)
+}
+
+// DownloadFile saves a remote file as localPath. Like Upload, it writes to a
+// ".part" file and renames it once it has the full size, so a failed
+// download never leaves a truncated file under the real name. The part file
+// is kept, and the next DownloadFile of the same path resumes from it.
+func (c *FTPClient) DownloadFile(remotePath, localPath string) error {
+	part := localPath + partSuffix
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = c.retrieve(remotePath, f, info.Size(), func() error { return f.Truncate(0) })
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if info, statErr := os.Stat(part); statErr == nil && info.Size() == 0 {
+			os.Remove(part)
+		}
+		return err
+	}
+	return os.Rename(part, localPath)
+}
+
+// retrieve downloads remotePath to w, which already holds the first written
+// bytes of it. Without a size to resume against, w is emptied with rewind
+// and the file downloaded from the start.
+func (c *FTPClient) retrieve(remotePath string, w io.Writer, written int64, rewind func() error) error {
+	total := int64(-1)
+	sized := false
+	return c.withRetries(func(conn *ftp.ServerConn, prev error) error {
+		if !sized {
+			size, err := conn.FileSize(remotePath)
+			var reply *textproto.Error
+			switch {
+			case err == nil:
+				total, sized = size, true
+			case !errors.As(err, &reply):
+				return err
+			}
+		}
+		if !sized {
+			return c.retrieveUnsized(conn, remotePath, w, written, rewind)
+		}
+		if written > total {
+			return fmt.Errorf("already have %d bytes of %s, more than its %d; delete the partial download", written, remotePath, total)
+		}
+		if prev != nil {
+			c.report(TransferProgress{Bytes: written, Total: total, Retry: prev})
+		}
+		if written == total {
+			return nil
+		}
+		resp, err := conn.RetrFrom(remotePath, uint64(written))
 		if err != nil {
 			return err
 		}
-		defer r.Close()
-		_, err = io.Copy(w, r)
-		return err
+		_, err = io.Copy(w, &countingReader{r: resp, n: &written, total: total, report: c.report})
+		if closeErr := resp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		if written != total {
+			return fmt.Errorf("download incomplete: got %d of %d bytes", written, total)
+		}
+		return nil
 	})
 }
 
+// retrieveUnsized downloads a file whose size the printer doesn't report.
+// Nothing tells a complete download from a cut one, so it is not resumed:
+// a failure ends the download.
+func (c *FTPClient) retrieveUnsized(conn *ftp.ServerConn, remotePath string, w io.Writer, written int64, rewind func() error) error {
+	if written > 0 {
+		if rewind == nil {
+			return noResumeError{fmt.Errorf("cannot resume %s without its size", remotePath)}
+		}
+		if err := rewind(); err != nil {
+			return err
+		}
+		written = 0
+	}
+	c.report(TransferProgress{Bytes: 0, Total: -1})
+	resp, err := conn.Retr(remotePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, &countingReader{r: resp, n: &written, total: -1, report: c.report})
+	if closeErr := resp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return noResumeError{briefError(err)}
+	}
+	return nil
+}
+
+// noResumeError marks a failed transfer that must not be retried.
+type noResumeError struct{ err error }
+
+func (e noResumeError) Error() string { return e.err.Error() }
+func (e noResumeError) Unwrap() error { return e.err }
+
 func (c *FTPClient) Delete(remotePath string) error {
 	return c.withConn(func(conn *ftp.ServerConn) error {
 		return conn.Delete(remotePath)
@@ -0,0 +1,102 @@
+package printer
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed data/hms_codes.json
+var hmsCodesJSON []byte
+
+// HMSAlert is a decoded health management message.
+type HMSAlert struct {
+	Code     string `json:"code"`
+	Module   string `json:"module"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type hmsTable struct {
+	Version string            `json:"version"`
+	Codes   map[string]string `json:"codes"`
+}
+
+var hmsCodes = mustLoadHMSTable(hmsCodesJSON)
+
+func mustLoadHMSTable(data []byte) hmsTable {
+	var t hmsTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		panic(fmt.Sprintf("invalid embedded HMS table: %v", err))
+	}
+	return t
+}
+
+var hmsModules = map[uint32]string{
+	0x03: "mc",
+	0x05: "mainboard",
+	0x07: "ams",
+	0x08: "toolhead",
+	0x0C: "xcam",
+}
+
+var hmsSeverities = map[uint32]string{
+	1: "fatal",
+	2: "serious",
+	3: "common",
+	4: "info",
+}
+
+const hmsModuleAMS = 0x07
+
+// FullCode returns the entry in the XXXX_XXXX_XXXX_XXXX form Bambu documents.
+func (e HMSEntry) FullCode() string {
+	return fmt.Sprintf("%04X_%04X_%04X_%04X", e.Attr>>16, e.Attr&0xFFFF, e.Code>>16, e.Code&0xFFFF)
+}
+
+// Decode looks the entry up in the HMS table. AMS messages are stored once,
+// for AMS A (and slot 1 where they concern a slot), and expanded for the
+// unit and slot in the entry.
+func (e HMSEntry) Decode() HMSAlert {
+	alert := HMSAlert{
+		Code:     e.FullCode(),
+		Module:   lookupOr(hmsModules, e.Attr>>24, "unknown"),
+		Severity: lookupOr(hmsSeverities, e.Code>>16, "unknown"),
+	}
+	if e.Attr>>24 == hmsModuleAMS {
+		unit := (e.Attr >> 16) & 0xFF
+		slot := (e.Attr >> 8) & 0xFF
+		generic := HMSEntry{Attr: e.Attr &^ 0x00FF0000, Code: e.Code}
+		if slot >= 0x20 && slot <= 0x23 {
+			generic.Attr = generic.Attr&^0xFF00 | 0x2000
+		}
+		if msg, ok := hmsCodes.Codes[generic.FullCode()]; ok {
+			msg = strings.ReplaceAll(msg, "{ams}", string(rune('A'+unit)))
+			alert.Message = strings.ReplaceAll(msg, "{slot}", fmt.Sprint(slot-0x1F))
+			return alert
+		}
+	}
+	if msg, ok := hmsCodes.Codes[alert.Code]; ok {
+		alert.Message = msg
+		return alert
+	}
+	alert.Message = "Unknown HMS code " + alert.Code
+	return alert
+}
+
+// DecodeHMS decodes all entries of a report.
+func DecodeHMS(entries []HMSEntry) []HMSAlert {
+	alerts := make([]HMSAlert, 0, len(entries))
+	for _, e := range entries {
+		alerts = append(alerts, e.Decode())
+	}
+	return alerts
+}
+
+func lookupOr(m map[uint32]string, key uint32, fallback string) string {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,24 @@
+package printer
+
+import "testing"
+
+func TestHMSDecode(t *testing.T) {
+	tests := []struct {
+		entry    HMSEntry
+		module   string
+		severity string
+		message  string
+	}{
+		{HMSEntry{Attr: 0x03000100, Code: 0x00010001}, "mc", "fatal", "The heatbed temperature is abnormal; the heater may have a short circuit."},
+		{HMSEntry{Attr: 0x07012200, Code: 0x00020001}, "ams", "serious", "AMS B slot 3 filament has run out."},
+		{HMSEntry{Attr: 0x07020100, Code: 0x00020002}, "ams", "serious", "The AMS C assist motor is overloaded. The filament may be tangled or stuck."},
+		{HMSEntry{Attr: 0x0C000300, Code: 0x00030008}, "xcam", "common", "Possible spaghetti defects were detected; check the print before continuing."},
+		{HMSEntry{Attr: 0x03FF0000, Code: 0x00040001}, "mc", "info", "Unknown HMS code 03FF_0000_0004_0001"},
+	}
+	for _, tt := range tests {
+		a := tt.entry.Decode()
+		if a.Module != tt.module || a.Severity != tt.severity || a.Message != tt.message {
+			t.Errorf("Decode(%s) = %+v", tt.entry.FullCode(), a)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package printer
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// serialPrefixes maps the first three characters of a printer serial to its
+// model.
+var serialPrefixes = map[string]string{
+	"00M": "X1C",
+	"00W": "X1",
+	"03W": "X1E",
+	"01P": "P1S",
+	"01S": "P1P",
+	"030": "A1 mini",
+	"039": "A1",
+	"094": "H2D",
+}
+
+// ModelFromSerial returns the printer model encoded in a serial, or "" if the
+// prefix is unknown.
+func ModelFromSerial(serial string) string {
+	if len(serial) < 3 {
+		return ""
+	}
+	return serialPrefixes[strings.ToUpper(serial[:3])]
+}
+
+// modelAliases maps other names in use for a model, lower-cased, to the
+// names in serialPrefixes: Bambu Studio's display names and its
+// printer_model_id values.
+var modelAliases = map[string]string{
+	"x1 carbon": "X1C",
+	"bl-p001":   "X1C",
+	"bl-p002":   "X1",
+	"c13":       "X1E",
+	"c12":       "P1S",
+	"c11":       "P1P",
+	"n1":        "A1 mini",
+	"n2s":       "A1",
+	"o1d":       "H2D",
+}
+
+// NormalizeModel returns the name ModelFromSerial uses for a model given by
+// any of its names, e.g. "Bambu Lab X1 Carbon" or "x1c" for "X1C". Unknown
+// names are returned trimmed.
+func NormalizeModel(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) > len("Bambu Lab ") && strings.EqualFold(name[:len("Bambu Lab ")], "Bambu Lab ") {
+		name = strings.TrimSpace(name[len("Bambu Lab "):])
+	}
+	for _, model := range serialPrefixes {
+		if strings.EqualFold(model, name) {
+			return model
+		}
+	}
+	if model, ok := modelAliases[strings.ToLower(name)]; ok {
+		return model
+	}
+	return name
+}
+
+// SameModel reports whether two model names refer to the same printer model.
+func SameModel(a, b string) bool {
+	return strings.EqualFold(NormalizeModel(a), NormalizeModel(b))
+}
+
+// SerialFromCertificate returns the serial a printer certificate was issued
+// for; printers carry it as the subject common name.
+func SerialFromCertificate(cert *x509.Certificate) string {
+	return strings.TrimSpace(cert.Subject.CommonName)
+}
+
+// SerialMismatchError reports that the printer identifies with a different
+// serial than the one configured, which would otherwise surface as a timeout
+// because reports are published on a topic named after the real serial.
+type SerialMismatchError struct {
+	Configured string
+	Printer    string
+}
+
+func (e *SerialMismatchError) Error() string {
+	return fmt.Sprintf("printer serial is %s but %s is configured; no reports arrive on the wrong topic", e.Printer, e.Configured)
+}
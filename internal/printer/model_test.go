@@ -0,0 +1,29 @@
+package printer
+
+import "testing"
+
+func TestNormalizeModel(t *testing.T) {
+	tests := map[string]string{
+		"X1C":                 "X1C",
+		"x1c":                 "X1C",
+		"X1 Carbon":           "X1C",
+		"Bambu Lab X1 Carbon": "X1C",
+		"BL-P001":             "X1C",
+		"Bambu Lab X1":        "X1",
+		"a1 MINI":             "A1 mini",
+		"Bambu Lab A1":        "A1",
+		"P1S":                 "P1S",
+		" Unknown 3D ":        "Unknown 3D",
+	}
+	for in, want := range tests {
+		if got := NormalizeModel(in); got != want {
+			t.Errorf("NormalizeModel(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if !SameModel("X1 Carbon", ModelFromSerial("00M09A000000000")) {
+		t.Error("X1 Carbon job does not match an X1C serial")
+	}
+	if SameModel("X1", "X1C") || SameModel("A1", "A1 mini") {
+		t.Error("different models match")
+	}
+}
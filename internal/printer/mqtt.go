@@ -6,7 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -17,81 +21,190 @@ type MQTTClient struct {
 	commandTopic string
 	serial       string
 
-	mu    sync.RWMutex
-	data  map[string]any
+	state *State
 	ready chan struct{}
+
+	subscribed chan struct{}
+	subOnce    sync.Once
+	seq        atomic.Uint64
+	pendingMu  sync.Mutex
+	pending    map[string]pendingRequest
+
+	subsMu  sync.Mutex
+	subs    map[int]chan Event
+	nextSub int
+
+	connMu sync.Mutex
+	conn   Connection
+	// peerSerial is the serial in the certificate the printer presented.
+	peerSerial atomic.Pointer[string]
+
+	recorder   atomic.Pointer[Recorder]
+	replay     bool
+	replayDone chan struct{}
+}
+
+// MQTTOptions tunes the MQTT connection. Zero values pick the defaults.
+type MQTTOptions struct {
+	Username string
+	Port     int
+	Timeout  time.Duration
+	// ReconnectMax caps the exponential backoff between reconnect attempts,
+	// which starts at one second.
+	ReconnectMax time.Duration
+	// KeepAlive is the ping interval; a dead link is noticed after about
+	// one and a half intervals.
+	KeepAlive time.Duration
+	// TLS verifies the printer; nil accepts any certificate.
+	TLS *tls.Config
+	// Recorder, when set, receives every report from the moment the
+	// client subscribes, so nothing sent in reply to the first pushall is
+	// missed.
+	Recorder *Recorder
 }
 
-func NewMQTTClient(ip, accessCode, serial, username string, port int, timeout time.Duration) (*MQTTClient, error) {
-	if username == "" {
-		username = "bblp"
+const (
+	defaultReconnectMax = 30 * time.Second
+	defaultKeepAlive    = 10 * time.Second
+)
+
+func NewMQTTClient(ip, accessCode, serial string, o MQTTOptions) (*MQTTClient, error) {
+	if o.Username == "" {
+		o.Username = "bblp"
+	}
+	if o.Port == 0 {
+		o.Port = 8883
+	}
+	if o.ReconnectMax <= 0 {
+		o.ReconnectMax = defaultReconnectMax
 	}
-	if port == 0 {
-		port = 8883
+	if o.KeepAlive <= 0 {
+		o.KeepAlive = defaultKeepAlive
+	}
+	if o.TLS == nil {
+		o.TLS = &tls.Config{InsecureSkipVerify: true}
+	}
+	mc := newMQTTClient(serial)
+	if o.Recorder != nil {
+		mc.recorder.Store(o.Recorder)
 	}
 
-	mc := &MQTTClient{
-		commandTopic: fmt.Sprintf("device/%s/request", serial),
-		serial:       serial,
-		data:         map[string]any{},
-		ready:        make(chan struct{}),
+	// paho flattens connection errors into strings; keep the certificate
+	// verification error so callers can recognise a pin mismatch. The
+	// presented serial is kept to explain a silent topic mismatch.
+	var verifyErr atomic.Pointer[error]
+	tlsConfig := o.TLS.Clone()
+	verify := tlsConfig.VerifyConnection
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) > 0 {
+			peer := SerialFromCertificate(cs.PeerCertificates[0])
+			mc.peerSerial.Store(&peer)
+		}
+		if verify == nil {
+			return nil
+		}
+		err := verify(cs)
+		if err != nil {
+			verifyErr.Store(&err)
+		}
+		return err
 	}
 
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("tls://%s:%d", ip, port))
-	opts.SetUsername(username)
+	opts.AddBroker(fmt.Sprintf("tls://%s:%d", ip, o.Port))
+	opts.SetUsername(o.Username)
 	opts.SetPassword(accessCode)
 	opts.SetClientID(fmt.Sprintf("bambu-cli-%d", time.Now().UnixNano()))
-	opts.SetConnectTimeout(timeout)
-	opts.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	opts.SetConnectTimeout(o.Timeout)
+	opts.SetTLSConfig(tlsConfig)
+	opts.SetKeepAlive(o.KeepAlive)
+	opts.SetPingTimeout(o.KeepAlive / 2)
 	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(o.ReconnectMax)
 	opts.SetOnConnectHandler(func(c mqtt.Client) {
 		topic := fmt.Sprintf("device/%s/report", serial)
 		if token := c.Subscribe(topic, 0, mc.onMessage); token.Wait() && token.Error() != nil {
 			return
 		}
+		mc.subOnce.Do(func() { close(mc.subscribed) })
+		if prev := mc.setConnState(ConnConnected, ""); prev == ConnReconnecting {
+			mc.emit(Event{Type: EventConnectionRestored, Time: time.Now()})
+			// Reports missed while offline are not replayed by the printer;
+			// ask for a full one. Handlers must not block on publishes.
+			go func() { _ = mc.PushAll() }()
+		}
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		ev := Event{Type: EventConnectionLost, Time: time.Now()}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		mc.setConnState(ConnReconnecting, ev.Error)
+		mc.emit(ev)
 	})
-	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {})
 
 	mc.client = mqtt.NewClient(opts)
 	if token := mc.client.Connect(); token.Wait() && token.Error() != nil {
+		if err := verifyErr.Load(); err != nil {
+			return nil, *err
+		}
 		return nil, token.Error()
 	}
 
 	return mc, nil
 }
 
+func newMQTTClient(serial string) *MQTTClient {
+	mc := &MQTTClient{
+		commandTopic: fmt.Sprintf("device/%s/request", serial),
+		serial:       serial,
+		state:        NewState(),
+		ready:        make(chan struct{}),
+		subscribed:   make(chan struct{}),
+		pending:      map[string]pendingRequest{},
+		subs:         map[int]chan Event{},
+		conn:         Connection{State: ConnDisconnected, Since: time.Now()},
+	}
+	// Seed the sequence counter randomly so replies to concurrent bambu-cli
+	// instances talking to the same printer do not collide.
+	mc.seq.Store(uint64(rand.Uint32()))
+	return mc
+}
+
 func (m *MQTTClient) Close() {
 	if m.client != nil && m.client.IsConnected() {
 		m.client.Disconnect(250)
 	}
+	m.setConnState(ConnDisconnected, "")
 }
 
 func (m *MQTTClient) onMessage(_ mqtt.Client, msg mqtt.Message) {
+	if r := m.recorder.Load(); r != nil {
+		_ = r.Record(msg.Topic(), msg.Payload())
+	}
+	m.handlePayload(msg.Payload())
+}
+
+func (m *MQTTClient) handlePayload(payload []byte) {
 	var doc map[string]any
-	dec := json.NewDecoder(bytes.NewReader(msg.Payload()))
+	dec := json.NewDecoder(bytes.NewReader(payload))
 	dec.UseNumber()
 	if err := dec.Decode(&doc); err != nil {
 		return
 	}
+	m.touch(time.Now())
 
-	m.mu.Lock()
-	for k, v := range doc {
-		existing, ok := m.data[k]
-		vMap, okV := v.(map[string]any)
-		if ok && okV {
-			existingMap, okExisting := existing.(map[string]any)
-			if okExisting {
-				for kk, vv := range vMap {
-					existingMap[kk] = vv
-				}
-				m.data[k] = existingMap
-				continue
-			}
-		}
-		m.data[k] = v
+	m.dispatchReplies(doc)
+
+	// Events are only diffed once there is a baseline; the first report
+	// would otherwise be compared against zero values.
+	if m.hasSubscribers() && m.state.HasReport() {
+		prev := m.state.Report()
+		m.state.Apply(doc)
+		m.emit(DiffReports(prev, m.state.Report(), time.Now())...)
+	} else {
+		m.state.Apply(doc)
 	}
-	m.mu.Unlock()
 
 	select {
 	case <-m.ready:
@@ -108,15 +221,41 @@ func (m *MQTTClient) WaitForData(timeout time.Duration) error {
 	case <-m.ready:
 		return nil
 	case <-time.After(timeout):
+		if err := m.serialMismatch(); err != nil {
+			return err
+		}
 		return errors.New("timeout waiting for printer data")
 	}
 }
 
+// serialMismatch returns a *SerialMismatchError when the printer's
+// certificate names a different serial than the one subscribed to.
+func (m *MQTTClient) serialMismatch() error {
+	peer := m.peerSerial.Load()
+	if peer == nil || *peer == "" || strings.EqualFold(*peer, m.serial) {
+		return nil
+	}
+	return &SerialMismatchError{Configured: m.serial, Printer: *peer}
+}
+
 func (m *MQTTClient) PushAll() error {
+	if m.replay {
+		return nil
+	}
+	// The report subscription is made asynchronously after connecting; a
+	// pushall sent before it is in place would answer into the void.
+	select {
+	case <-m.subscribed:
+	case <-time.After(5 * time.Second):
+		return errors.New("timeout subscribing to printer reports")
+	}
 	return m.Publish(map[string]any{"pushing": map[string]any{"command": "pushall"}})
 }
 
 func (m *MQTTClient) Publish(payload any) error {
+	if m.replay {
+		return errors.New("cannot send commands while replaying a recording")
+	}
 	if m.client == nil || !m.client.IsConnected() {
 		return errors.New("mqtt not connected")
 	}
@@ -131,29 +270,107 @@ func (m *MQTTClient) Publish(payload any) error {
 	return ok.Error()
 }
 
-func (m *MQTTClient) Snapshot() map[string]any {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	out := map[string]any{}
-	for k, v := range m.data {
-		out[k] = v
+// Request publishes a command payload stamped with a fresh sequence_id and
+// waits for the printer to echo it back on the report topic. A reply with a
+// non-success result is returned as a *CommandError; no reply within timeout
+// yields ErrReplyTimeout.
+func (m *MQTTClient) Request(payload map[string]any, timeout time.Duration) (Reply, error) {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	section, err := commandSection(payload)
+	if err != nil {
+		return Reply{}, err
+	}
+	seq := strconv.FormatUint(m.seq.Add(1), 10)
+	section["sequence_id"] = seq
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case <-m.subscribed:
+	case <-deadline.C:
+		return Reply{}, errors.New("timeout subscribing to printer reports")
+	}
+
+	ch := make(chan Reply, 1)
+	m.pendingMu.Lock()
+	m.pending[seq] = pendingRequest{command: stringField(section["command"]), ch: ch}
+	m.pendingMu.Unlock()
+	defer func() {
+		m.pendingMu.Lock()
+		delete(m.pending, seq)
+		m.pendingMu.Unlock()
+	}()
+
+	if err := m.Publish(payload); err != nil {
+		return Reply{}, err
+	}
+
+	select {
+	case reply := <-ch:
+		if !reply.OK() {
+			return reply, &CommandError{Command: reply.Command, Result: reply.Result, Reason: reply.Reason}
+		}
+		return reply, nil
+	case <-deadline.C:
+		if err := m.serialMismatch(); err != nil {
+			return Reply{}, err
+		}
+		return Reply{}, ErrReplyTimeout
 	}
-	return out
 }
 
-func (m *MQTTClient) Get(path ...string) (any, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	var current any = m.data
-	for _, p := range path {
-		mMap, ok := current.(map[string]any)
-		if !ok {
-			return nil, false
+func commandSection(payload map[string]any) (map[string]any, error) {
+	for _, v := range payload {
+		if section, ok := v.(map[string]any); ok {
+			return section, nil
 		}
-		current, ok = mMap[p]
+	}
+	return nil, errors.New("payload has no command section")
+}
+
+// pendingRequest is a command waiting for its reply.
+type pendingRequest struct {
+	command string
+	ch      chan Reply
+}
+
+// dispatchReplies hands replies to the requests waiting for them. A reply
+// must carry both the request's sequence_id and its command: status pushes
+// and replies to other clients' commands can reuse a sequence_id.
+func (m *MQTTClient) dispatchReplies(doc map[string]any) {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	if len(m.pending) == 0 {
+		return
+	}
+	for _, v := range doc {
+		section, ok := v.(map[string]any)
 		if !ok {
-			return nil, false
+			continue
+		}
+		reply := parseReply(section)
+		if reply.SequenceID == "" {
+			continue
+		}
+		p, ok := m.pending[reply.SequenceID]
+		if !ok || !strings.EqualFold(reply.Command, p.command) {
+			continue
+		}
+		select {
+		case p.ch <- reply:
+		default:
 		}
 	}
-	return current, true
+}
+
+func (m *MQTTClient) Snapshot() map[string]any {
+	return m.state.Snapshot()
+}
+
+// Report returns the typed "print" section of the cached state. Callers must
+// not modify its slices or maps.
+func (m *MQTTClient) Report() PrintReport {
+	return m.state.Report()
 }
@@ -0,0 +1,57 @@
+package printer
+
+import "testing"
+
+func TestDispatchRepliesMatchesCommand(t *testing.T) {
+	m := newMQTTClient("SERIAL")
+	ch := make(chan Reply, 1)
+	m.pending["42"] = pendingRequest{command: "pause", ch: ch}
+
+	// A status push or another command's reply reusing the sequence_id
+	// must not complete the request.
+	m.dispatchReplies(map[string]any{"print": map[string]any{"command": "push_status", "sequence_id": "42"}})
+	m.dispatchReplies(map[string]any{"print": map[string]any{"command": "resume", "sequence_id": "42", "result": "fail"}})
+	select {
+	case r := <-ch:
+		t.Fatalf("request completed by unrelated message %+v", r)
+	default:
+	}
+
+	m.dispatchReplies(map[string]any{"print": map[string]any{"command": "pause", "sequence_id": "42", "result": "success"}})
+	select {
+	case r := <-ch:
+		if !r.OK() || r.Command != "pause" {
+			t.Fatalf("reply = %+v", r)
+		}
+	default:
+		t.Fatal("matching reply was not delivered")
+	}
+}
+
+func TestHandlePayloadDiffsAgainstBaseline(t *testing.T) {
+	m := newMQTTClient("SERIAL")
+	events, unsubscribe := m.Subscribe(16)
+	defer unsubscribe()
+
+	m.handlePayload([]byte(`{"print":{"command":"push_status","msg":0,"gcode_state":"RUNNING","layer_num":12,"bed_temper":60}}`))
+	select {
+	case ev := <-events:
+		t.Fatalf("first report emitted %+v", ev)
+	default:
+	}
+
+	m.handlePayload([]byte(`{"print":{"command":"push_status","msg":1,"gcode_state":"PAUSE"}}`))
+	select {
+	case ev := <-events:
+		if ev.Type != EventStateChanged || ev.PrevState != GcodeStateRunning || ev.State != GcodeStatePause {
+			t.Fatalf("event = %+v", ev)
+		}
+	default:
+		t.Fatal("state change not emitted")
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v", ev)
+	default:
+	}
+}
@@ -1,5 +1,7 @@
 package printer
 
+import "strconv"
+
 func PayloadLight(on bool) map[string]any {
 	mode := "off"
 	if on {
@@ -7,7 +9,13 @@ func PayloadLight(on bool) map[string]any {
 	}
 	return map[string]any{
 		"system": map[string]any{
-			"led_mode": mode,
+			"command":       "ledctrl",
+			"led_node":      "chamber_light",
+			"led_mode":      mode,
+			"led_on_time":   500,
+			"led_off_time":  500,
+			"loop_times":    0,
+			"interval_time": 0,
 		},
 	}
 }
@@ -27,35 +35,68 @@ func PayloadPrintResume() map[string]any {
 func PayloadGcode(line string) map[string]any {
 	return map[string]any{
 		"print": map[string]any{
-			"sequence_id": "0",
-			"command":     "gcode_line",
-			"param":       line,
+			"command": "gcode_line",
+			"param":   line,
 		},
 	}
 }
 
-func PayloadStartPrint(filename string, plateLocation string, useAMS bool, amsMapping []int, skipObjects []int, flowCalibration bool) map[string]any {
-	payload := map[string]any{
-		"print": map[string]any{
-			"command":        "project_file",
-			"param":          plateLocation,
-			"file":           filename,
-			"bed_leveling":   true,
-			"bed_type":       "textured_plate",
-			"flow_cali":      flowCalibration,
-			"vibration_cali": true,
-			"url":            "ftp:///" + filename,
-			"layer_inspect":  false,
-			"sequence_id":    "10000000",
-			"use_ams":        useAMS,
-			"ams_mapping":    amsMapping,
-			"skip_objects":   nil,
-		},
+// StartPrintOptions are the fields of a project_file command.
+type StartPrintOptions struct {
+	Filename      string // path on the printer's storage
+	PlateLocation string // e.g. "Metadata/plate_1.gcode"
+	UseAMS        bool
+	AMSMapping    []int
+	SkipObjects   []int
+	// BedType is the installed plate identifier, e.g. "textured_plate"; empty
+	// sends "textured_plate".
+	BedType              string
+	BedLeveling          bool
+	FlowCalibration      bool
+	VibrationCalibration bool
+	LayerInspect         bool // first-layer inspection (lidar)
+	Timelapse            bool
+	// MD5 of the plate's gcode, upper-case hex. The printer verifies the
+	// file against it when set.
+	MD5 string
+}
+
+func PayloadStartPrint(o StartPrintOptions) map[string]any {
+	cmd := map[string]any{
+		"command":        "project_file",
+		"param":          o.PlateLocation,
+		"file":           o.Filename,
+		"url":            "ftp:///" + o.Filename,
+		"bed_type":       o.BedType,
+		"bed_leveling":   o.BedLeveling,
+		"flow_cali":      o.FlowCalibration,
+		"vibration_cali": o.VibrationCalibration,
+		"layer_inspect":  o.LayerInspect,
+		"timelapse":      o.Timelapse,
+		"use_ams":        o.UseAMS,
+		"ams_mapping":    o.AMSMapping,
+		"skip_objects":   nil,
+	}
+	if o.BedType == "" {
+		cmd["bed_type"] = "textured_plate"
 	}
-	if skipObjects != nil && len(skipObjects) > 0 {
-		payload["print"].(map[string]any)["skip_objects"] = skipObjects
+	if o.MD5 != "" {
+		cmd["md5"] = o.MD5
 	}
-	return payload
+	if len(o.SkipObjects) > 0 {
+		cmd["skip_objects"] = o.SkipObjects
+	}
+	return map[string]any{"print": cmd}
+}
+
+func PayloadPrintSpeed(level SpeedLevel) map[string]any {
+	return map[string]any{"print": map[string]any{"command": "print_speed", "param": strconv.Itoa(int(level))}}
+}
+
+// PayloadSkipObjects cancels objects of the running job, by the identify_id
+// the slicer gave them.
+func PayloadSkipObjects(ids []int) map[string]any {
+	return map[string]any{"print": map[string]any{"command": "skip_objects", "obj_list": ids}}
 }
 
 func PayloadCalibration(bedLevel, motorNoise, vibration bool) map[string]any {
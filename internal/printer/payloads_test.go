@@ -0,0 +1,18 @@
+package printer
+
+import "testing"
+
+func TestPayloadStartPrintBedType(t *testing.T) {
+	tests := []struct {
+		bedType, want string
+	}{
+		{"", "textured_plate"},
+		{"cool_plate", "cool_plate"},
+	}
+	for _, tt := range tests {
+		cmd := PayloadStartPrint(StartPrintOptions{Filename: "job.3mf", BedType: tt.bedType})["print"].(map[string]any)
+		if got := cmd["bed_type"]; got != tt.want {
+			t.Errorf("bed type %q: sent %v, want %s", tt.bedType, got, tt.want)
+		}
+	}
+}
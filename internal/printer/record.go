@@ -0,0 +1,129 @@
+package printer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordedMessage is one line of a session recording.
+type RecordedMessage struct {
+	Time    time.Time       `json:"time"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Recorder writes raw printer reports as JSON lines.
+type Recorder struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	count int
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes one message. Payloads that are not valid JSON are skipped,
+// as the client would ignore them too.
+func (r *Recorder) Record(topic string, payload []byte) error {
+	if !json.Valid(payload) {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count++
+	return r.enc.Encode(RecordedMessage{Time: time.Now(), Topic: topic, Payload: payload})
+}
+
+// Count returns the number of messages recorded so far.
+func (r *Recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// SetRecorder makes the client write every received report to r, or stops
+// recording when r is nil. To record from the start of the connection, pass
+// the recorder in MQTTOptions instead.
+func (m *MQTTClient) SetRecorder(r *Recorder) {
+	m.recorder.Store(r)
+}
+
+// ReadRecording loads a session recorded with Recorder.
+func ReadRecording(path string) ([]RecordedMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var msgs []RecordedMessage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var msg RecordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, scanner.Err()
+}
+
+// NewReplayClient returns a read-only client fed from a recording instead of
+// a printer. Messages are replayed with their original spacing divided by
+// speed; a speed of 0 or less applies them all at once. When the recording
+// ends an EventConnectionLost is emitted.
+func NewReplayClient(path string, speed float64) (*MQTTClient, error) {
+	msgs, err := ReadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("%s: recording is empty", path)
+	}
+	mc := newMQTTClient("")
+	mc.replay = true
+	mc.replayDone = make(chan struct{})
+	mc.subOnce.Do(func() { close(mc.subscribed) })
+	mc.setConnState(ConnConnected, "")
+
+	if speed <= 0 {
+		for _, msg := range msgs {
+			mc.handlePayload(msg.Payload)
+		}
+		mc.setConnState(ConnDisconnected, "end of recording")
+		close(mc.replayDone)
+		return mc, nil
+	}
+	go func() {
+		start := msgs[0].Time
+		began := time.Now()
+		for _, msg := range msgs {
+			offset := time.Duration(float64(msg.Time.Sub(start)) / speed)
+			if wait := time.Until(began.Add(offset)); wait > 0 {
+				time.Sleep(wait)
+			}
+			mc.handlePayload(msg.Payload)
+		}
+		mc.setConnState(ConnDisconnected, "end of recording")
+		mc.emit(Event{Type: EventConnectionLost, Time: time.Now(), Error: "end of recording"})
+		close(mc.replayDone)
+	}()
+	return mc, nil
+}
+
+// ReplayDone is closed once a replay client has applied its whole recording.
+// It returns nil, which never fires, for live clients.
+func (m *MQTTClient) ReplayDone() <-chan struct{} {
+	return m.replayDone
+}
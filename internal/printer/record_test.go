@@ -0,0 +1,84 @@
+package printer
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// testdata/pause_resume.jsonl was recorded from the simulator: a six-layer
+// print paused by a filament runout at layer 3, resumed and finished.
+const pauseResumeRecording = "testdata/pause_resume.jsonl"
+
+func TestReadRecording(t *testing.T) {
+	msgs, err := ReadRecording(pauseResumeRecording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 21 {
+		t.Fatalf("read %d messages, want 21", len(msgs))
+	}
+	for i, msg := range msgs {
+		if msg.Topic != "device/SIMA/report" {
+			t.Errorf("message %d topic = %q", i, msg.Topic)
+		}
+		if i > 0 && msg.Time.Before(msgs[i-1].Time) {
+			t.Errorf("message %d is out of order", i)
+		}
+	}
+}
+
+func TestReplayAppliesWholeRecording(t *testing.T) {
+	client, err := NewReplayClient(pauseResumeRecording, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-client.ReplayDone():
+	default:
+		t.Fatal("replay at speed 0 returned before the end of the recording")
+	}
+	status := GetStatus(client)
+	if status.GcodeState != GcodeStateFinish || status.LayerCurrent != 6 || status.Percent != 100 {
+		t.Errorf("final status = %+v", status)
+	}
+	if err := client.PushAll(); err != nil {
+		t.Errorf("PushAll on a replay = %v, want a no-op", err)
+	}
+	if err := client.Publish(PayloadPrintStop()); err == nil {
+		t.Error("replay client accepted a command")
+	}
+}
+
+func TestReplayEmitsEvents(t *testing.T) {
+	client, err := NewReplayClient(pauseResumeRecording, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, unsubscribe := client.Subscribe(256)
+	defer unsubscribe()
+
+	select {
+	case <-client.ReplayDone():
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay did not finish")
+	}
+	var states []GcodeState
+	var lost bool
+	for len(events) > 0 {
+		ev := <-events
+		switch ev.Type {
+		case EventStateChanged:
+			states = append(states, ev.State)
+		case EventConnectionLost:
+			lost = ev.Error == "end of recording"
+		}
+	}
+	want := []GcodeState{GcodeStatePrepare, GcodeStateRunning, GcodeStatePause, GcodeStateRunning, GcodeStateFinish}
+	if !slices.Equal(states, want) {
+		t.Errorf("state events = %v, want %v", states, want)
+	}
+	if !lost {
+		t.Error("end of recording was not reported")
+	}
+}
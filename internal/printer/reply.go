@@ -0,0 +1,64 @@
+package printer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrReplyTimeout is returned by Request when the printer does not answer a
+// command within the given timeout.
+var ErrReplyTimeout = errors.New("timeout waiting for printer reply")
+
+// Reply is the printer's answer to a command sent with Request.
+type Reply struct {
+	SequenceID string         `json:"sequence_id"`
+	Command    string         `json:"command"`
+	Result     string         `json:"result"`
+	Reason     string         `json:"reason"`
+	Raw        map[string]any `json:"-"`
+}
+
+// OK reports whether the printer accepted the command. Replies without a
+// result field are treated as accepted.
+func (r Reply) OK() bool {
+	return r.Result == "" || strings.EqualFold(r.Result, "success")
+}
+
+// CommandError is returned by Request when the printer rejects a command.
+type CommandError struct {
+	Command string
+	Result  string
+	Reason  string
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("printer rejected %s", e.Command)
+	if e.Result != "" {
+		msg += fmt.Sprintf(" (result=%s)", e.Result)
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+func parseReply(section map[string]any) Reply {
+	return Reply{
+		SequenceID: stringField(section["sequence_id"]),
+		Command:    stringField(section["command"]),
+		Result:     stringField(section["result"]),
+		Reason:     stringField(section["reason"]),
+		Raw:        section,
+	}
+}
+
+func stringField(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,254 @@
+package printer
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// PrintReport is the typed form of the "print" section of a printer report.
+// Fields the model does not know about are kept in Extra and written back
+// out by MarshalJSON, so raw data can still be passed through.
+type PrintReport struct {
+	GcodeState         string        `json:"gcode_state,omitempty"`
+	Stage              *int          `json:"stg_cur,omitempty"`
+	Percent            int           `json:"mc_percent,omitempty"`
+	RemainingMinutes   *int          `json:"mc_remaining_time,omitempty"`
+	LayerNum           int           `json:"layer_num,omitempty"`
+	TotalLayerNum      int           `json:"total_layer_num,omitempty"`
+	BedTemper          float64       `json:"bed_temper,omitempty"`
+	BedTargetTemper    float64       `json:"bed_target_temper,omitempty"`
+	NozzleTemper       float64       `json:"nozzle_temper,omitempty"`
+	NozzleTargetTemper float64       `json:"nozzle_target_temper,omitempty"`
+	ChamberTemper      *float64      `json:"chamber_temper,omitempty"`
+	CoolingFanSpeed    string        `json:"cooling_fan_speed,omitempty"`
+	BigFan1Speed       string        `json:"big_fan1_speed,omitempty"`
+	BigFan2Speed       string        `json:"big_fan2_speed,omitempty"`
+	HeatbreakFanSpeed  string        `json:"heatbreak_fan_speed,omitempty"`
+	SpeedLevel         int           `json:"spd_lvl,omitempty"`
+	SpeedMagnitude     int           `json:"spd_mag,omitempty"`
+	GcodeFile          string        `json:"gcode_file,omitempty"`
+	SubtaskName        string        `json:"subtask_name,omitempty"`
+	SkippedObjects     []int         `json:"s_obj,omitempty"`
+	PrintError         int           `json:"print_error,omitempty"`
+	WifiSignal         string        `json:"wifi_signal,omitempty"`
+	LightsReport       []LightReport `json:"lights_report,omitempty"`
+	AMS                *AMSReport    `json:"ams,omitempty"`
+	VTTray             *AMSTray      `json:"vt_tray,omitempty"`
+	HMS                []HMSEntry    `json:"hms,omitempty"`
+	IPCam              *IPCamReport  `json:"ipcam,omitempty"`
+	UpgradeState       *UpgradeState `json:"upgrade_state,omitempty"`
+	NozzleDiameter     string        `json:"nozzle_diameter,omitempty"`
+	NozzleType         string        `json:"nozzle_type,omitempty"`
+	HomeFlag           int           `json:"home_flag,omitempty"`
+	SDCard             bool          `json:"sdcard,omitempty"`
+	Device             *DeviceReport `json:"device,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type LightReport struct {
+	Node string `json:"node"`
+	Mode string `json:"mode"`
+}
+
+type AMSReport struct {
+	Units         []AMSUnit `json:"ams,omitempty"`
+	AMSExistBits  string    `json:"ams_exist_bits,omitempty"`
+	TrayExistBits string    `json:"tray_exist_bits,omitempty"`
+	TrayNow       string    `json:"tray_now,omitempty"`
+	TrayPre       string    `json:"tray_pre,omitempty"`
+	TrayTar       string    `json:"tray_tar,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type AMSUnit struct {
+	ID       string    `json:"id"`
+	Humidity string    `json:"humidity,omitempty"`
+	Temp     string    `json:"temp,omitempty"`
+	Trays    []AMSTray `json:"tray,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type AMSTray struct {
+	ID            string `json:"id"`
+	TrayIDName    string `json:"tray_id_name,omitempty"`
+	TrayType      string `json:"tray_type,omitempty"`
+	TraySubBrands string `json:"tray_sub_brands,omitempty"`
+	TrayColor     string `json:"tray_color,omitempty"`
+	TrayInfoIdx   string `json:"tray_info_idx,omitempty"`
+	TrayWeight    string `json:"tray_weight,omitempty"`
+	TrayDiameter  string `json:"tray_diameter,omitempty"`
+	NozzleTempMin string `json:"nozzle_temp_min,omitempty"`
+	NozzleTempMax string `json:"nozzle_temp_max,omitempty"`
+	Remain        int    `json:"remain,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// HMSEntry is a raw health management message as reported by the printer.
+type HMSEntry struct {
+	Attr uint32 `json:"attr"`
+	Code uint32 `json:"code"`
+}
+
+type IPCamReport struct {
+	IPCamDev    string `json:"ipcam_dev,omitempty"`
+	IPCamRecord string `json:"ipcam_record,omitempty"`
+	Timelapse   string `json:"timelapse,omitempty"`
+	Resolution  string `json:"resolution,omitempty"`
+}
+
+type UpgradeState struct {
+	Status          string `json:"status,omitempty"`
+	Progress        string `json:"progress,omitempty"`
+	Message         string `json:"message,omitempty"`
+	Module          string `json:"module,omitempty"`
+	NewVersionState int    `json:"new_version_state,omitempty"`
+	ErrCode         int    `json:"err_code,omitempty"`
+}
+
+type DeviceReport struct {
+	CTC *ChamberControl `json:"ctc,omitempty"`
+}
+
+type ChamberControl struct {
+	Info struct {
+		Temp float64 `json:"temp"`
+	} `json:"info"`
+}
+
+type printReportAlias PrintReport
+
+func (r *PrintReport) UnmarshalJSON(data []byte) error {
+	extra, err := decodeWithExtra(data, (*printReportAlias)(r))
+	r.Extra = extra
+	return err
+}
+
+func (r PrintReport) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(printReportAlias(r), r.Extra)
+}
+
+type amsReportAlias AMSReport
+
+func (r *AMSReport) UnmarshalJSON(data []byte) error {
+	extra, err := decodeWithExtra(data, (*amsReportAlias)(r))
+	r.Extra = extra
+	return err
+}
+
+func (r AMSReport) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(amsReportAlias(r), r.Extra)
+}
+
+type amsUnitAlias AMSUnit
+
+func (u *AMSUnit) UnmarshalJSON(data []byte) error {
+	extra, err := decodeWithExtra(data, (*amsUnitAlias)(u))
+	u.Extra = extra
+	return err
+}
+
+func (u AMSUnit) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(amsUnitAlias(u), u.Extra)
+}
+
+type amsTrayAlias AMSTray
+
+func (t *AMSTray) UnmarshalJSON(data []byte) error {
+	extra, err := decodeWithExtra(data, (*amsTrayAlias)(t))
+	t.Extra = extra
+	return err
+}
+
+func (t AMSTray) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(amsTrayAlias(t), t.Extra)
+}
+
+// DecodePrintReport converts a raw "print" section into a PrintReport.
+func DecodePrintReport(section any) (PrintReport, error) {
+	var r PrintReport
+	if section == nil {
+		return r, nil
+	}
+	data, err := json.Marshal(section)
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(data, &r)
+	return r, err
+}
+
+// decodeWithExtra decodes data into v and returns the fields v has no json
+// tag for. Type mismatches on individual fields are tolerated because
+// firmware versions disagree on whether some values are strings or numbers:
+// the field is left at its zero value and its raw value is kept with the
+// extra fields, so it is not lost.
+func decodeWithExtra(data []byte, v any) (map[string]json.RawMessage, error) {
+	mismatched := false
+	if err := json.Unmarshal(data, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return nil, err
+		}
+		mismatched = true
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for key, typ := range jsonFields(v) {
+		if mismatched && raw[key] != nil && !decodes(raw[key], typ) {
+			continue
+		}
+		delete(raw, key)
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	return raw, nil
+}
+
+// decodes reports whether data decodes into a value of type t.
+func decodes(data json.RawMessage, t reflect.Type) bool {
+	return json.Unmarshal(data, reflect.New(t).Interface()) == nil
+}
+
+// encodeWithExtra marshals v and adds the extra fields. An extra field with
+// the same name as one of v's holds the raw value that could not be decoded
+// into it, and takes precedence over the zero value left behind.
+func encodeWithExtra(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for k, raw := range extra {
+		merged[k] = raw
+	}
+	return json.Marshal(merged)
+}
+
+// jsonFields maps the json names of v's fields to their types.
+func jsonFields(v any) map[string]reflect.Type {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = f.Type
+		}
+	}
+	return fields
+}
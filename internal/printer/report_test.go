@@ -0,0 +1,40 @@
+package printer
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodePrintReportKeepsMistypedFields(t *testing.T) {
+	section := map[string]any{
+		"gcode_state": "RUNNING",
+		"mc_percent":  "42",
+		"layer_num":   7,
+		"new_field":   true,
+	}
+	r, err := DecodePrintReport(section)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.GcodeState != "RUNNING" || r.LayerNum != 7 {
+		t.Fatalf("report = %+v", r)
+	}
+	if string(r.Extra["mc_percent"]) != `"42"` || string(r.Extra["new_field"]) != "true" {
+		t.Fatalf("extra = %v", r.Extra)
+	}
+	if _, ok := r.Extra["layer_num"]; ok {
+		t.Fatal("decoded field kept in extra")
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["mc_percent"] != "42" || out["new_field"] != true {
+		t.Fatalf("re-encoded = %s", data)
+	}
+}
@@ -0,0 +1,320 @@
+package sim
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// MQTT 3.1.1 control packet types used by the broker.
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// maxPacketSize bounds the remaining length the broker accepts, so a bogus
+// header cannot make it allocate up to the protocol's 256 MB limit. Printer
+// requests are a few hundred bytes.
+const maxPacketSize = 1 << 20
+
+// broker is a minimal MQTT broker: it authenticates clients, tracks
+// subscriptions to the report topic and hands request payloads to the
+// simulated printer.
+type broker struct {
+	reportTopic  string
+	requestTopic string
+	username     string
+	password     string
+	onRequest    func([]byte)
+
+	mu      sync.Mutex
+	clients map[*brokerConn]bool
+}
+
+type brokerConn struct {
+	conn net.Conn
+	mu   sync.Mutex
+	subs map[string]bool
+}
+
+func newBroker(serial, username, password string) *broker {
+	return &broker{
+		reportTopic:  fmt.Sprintf("device/%s/report", serial),
+		requestTopic: fmt.Sprintf("device/%s/request", serial),
+		username:     username,
+		password:     password,
+		clients:      map[*brokerConn]bool{},
+	}
+}
+
+func (b *broker) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	bc := &brokerConn{conn: conn, subs: map[string]bool{}}
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, bc)
+		b.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	typ, _, body, err := readPacket(r)
+	if err != nil || typ != packetConnect {
+		return
+	}
+	user, pass, err := parseConnect(body)
+	if err != nil {
+		return
+	}
+	if user != b.username || pass != b.password {
+		_ = bc.write(packetConnack<<4, []byte{0, 5})
+		return
+	}
+	if err := bc.write(packetConnack<<4, []byte{0, 0}); err != nil {
+		return
+	}
+	b.mu.Lock()
+	b.clients[bc] = true
+	b.mu.Unlock()
+
+	for {
+		typ, flags, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case packetPublish:
+			topic, payload, id, err := parsePublish(flags, body)
+			if err != nil {
+				return
+			}
+			if id != 0 {
+				_ = bc.write(packetPuback<<4, []byte{byte(id >> 8), byte(id)})
+			}
+			if topic == b.requestTopic && b.onRequest != nil {
+				b.onRequest(payload)
+			}
+		case packetSubscribe:
+			id, topics, err := parseSubscribe(body)
+			if err != nil {
+				return
+			}
+			ack := []byte{byte(id >> 8), byte(id)}
+			bc.mu.Lock()
+			for _, t := range topics {
+				bc.subs[t] = true
+				ack = append(ack, 0)
+			}
+			bc.mu.Unlock()
+			_ = bc.write(packetSuback<<4, ack)
+		case packetUnsubscribe:
+			id, topics, err := parseUnsubscribe(body)
+			if err != nil {
+				return
+			}
+			bc.mu.Lock()
+			for _, t := range topics {
+				delete(bc.subs, t)
+			}
+			bc.mu.Unlock()
+			_ = bc.write(packetUnsuback<<4, []byte{byte(id >> 8), byte(id)})
+		case packetPingreq:
+			_ = bc.write(packetPingresp<<4, nil)
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+// publishReport sends a payload on the report topic to every subscriber.
+func (b *broker) publishReport(payload []byte) {
+	body := appendString(nil, b.reportTopic)
+	body = append(body, payload...)
+	b.mu.Lock()
+	clients := make([]*brokerConn, 0, len(b.clients))
+	for c := range b.clients {
+		clients = append(clients, c)
+	}
+	b.mu.Unlock()
+	for _, c := range clients {
+		if c.subscribed(b.reportTopic) {
+			_ = c.write(packetPublish<<4, body)
+		}
+	}
+}
+
+func (c *brokerConn) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subs[topic] || c.subs["#"]
+}
+
+func (c *brokerConn) write(header byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	packet := []byte{header}
+	packet = appendLength(packet, len(body))
+	packet = append(packet, body...)
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+func readPacket(r *bufio.Reader) (byte, byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	length, err := readLength(r)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if length > maxPacketSize {
+		return 0, 0, nil, fmt.Errorf("packet of %d bytes exceeds the %d byte limit", length, maxPacketSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0x0F, body, nil
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	length, shift := 0, 0
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			return length, nil
+		}
+		shift += 7
+	}
+	return 0, errors.New("malformed remaining length")
+}
+
+func appendLength(buf []byte, n int) []byte {
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			return buf
+		}
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+type packetReader struct {
+	buf []byte
+	err error
+}
+
+func (p *packetReader) uint16() uint16 {
+	if p.err != nil || len(p.buf) < 2 {
+		p.err = errors.New("short packet")
+		return 0
+	}
+	v := binary.BigEndian.Uint16(p.buf)
+	p.buf = p.buf[2:]
+	return v
+}
+
+func (p *packetReader) bytes(n int) []byte {
+	if p.err != nil || len(p.buf) < n {
+		p.err = errors.New("short packet")
+		return nil
+	}
+	v := p.buf[:n]
+	p.buf = p.buf[n:]
+	return v
+}
+
+func (p *packetReader) string() string {
+	return string(p.bytes(int(p.uint16())))
+}
+
+func parseConnect(body []byte) (string, string, error) {
+	p := &packetReader{buf: body}
+	p.string() // protocol name
+	p.bytes(1) // protocol level
+	flags := p.bytes(1)
+	p.uint16() // keep alive
+	p.string() // client id
+	if p.err != nil {
+		return "", "", p.err
+	}
+	var user, pass string
+	if flags[0]&0x04 != 0 {
+		p.string() // will topic
+		p.string() // will message
+	}
+	if flags[0]&0x80 != 0 {
+		user = p.string()
+	}
+	if flags[0]&0x40 != 0 {
+		pass = p.string()
+	}
+	return user, pass, p.err
+}
+
+func parsePublish(flags byte, body []byte) (string, []byte, uint16, error) {
+	p := &packetReader{buf: body}
+	topic := p.string()
+	var id uint16
+	if (flags>>1)&0x03 > 0 {
+		id = p.uint16()
+	}
+	return topic, p.buf, id, p.err
+}
+
+func parseSubscribe(body []byte) (uint16, []string, error) {
+	p := &packetReader{buf: body}
+	id := p.uint16()
+	var topics []string
+	for p.err == nil && len(p.buf) > 0 {
+		topics = append(topics, p.string())
+		p.bytes(1) // requested QoS
+	}
+	return id, topics, p.err
+}
+
+func parseUnsubscribe(body []byte) (uint16, []string, error) {
+	p := &packetReader{buf: body}
+	id := p.uint16()
+	var topics []string
+	for p.err == nil && len(p.buf) > 0 {
+		topics = append(topics, p.string())
+	}
+	return id, topics, p.err
+}
@@ -0,0 +1,27 @@
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestReadPacket(t *testing.T) {
+	packet := append([]byte{packetPublish<<4 | 0x02}, appendLength(nil, 3)...)
+	packet = append(packet, 'a', 'b', 'c')
+	typ, flags, body, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != packetPublish || flags != 0x02 || string(body) != "abc" {
+		t.Errorf("readPacket = %d, %#x, %q", typ, flags, body)
+	}
+}
+
+func TestReadPacketRejectsOversizedLength(t *testing.T) {
+	// A header declaring the protocol maximum of 256 MB, with no body.
+	packet := []byte{packetPublish << 4, 0xFF, 0xFF, 0xFF, 0x7F}
+	if _, _, _, err := readPacket(bufio.NewReader(bytes.NewReader(packet))); err == nil {
+		t.Fatal("oversized packet accepted")
+	}
+}
@@ -0,0 +1,88 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net"
+	"time"
+)
+
+// cameraServer streams JPEG frames using the printer's camera framing: an
+// 80-byte auth packet from the client, then a 16-byte header carrying the
+// frame size before each frame.
+type cameraServer struct {
+	username string
+	password string
+	interval time.Duration
+}
+
+func newCameraServer(username, password string, interval time.Duration) *cameraServer {
+	return &cameraServer{username: username, password: password, interval: interval}
+}
+
+func (c *cameraServer) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go c.handle(conn)
+	}
+}
+
+func (c *cameraServer) handle(conn net.Conn) {
+	defer conn.Close()
+	auth := make([]byte, 80)
+	if _, err := io.ReadFull(conn, auth); err != nil {
+		return
+	}
+	user := string(bytes.TrimRight(auth[16:48], "\x00"))
+	pass := string(bytes.TrimRight(auth[48:80], "\x00"))
+	if user != c.username || pass != c.password {
+		return
+	}
+	for frame := 0; ; frame++ {
+		img, err := cameraFrame(frame)
+		if err != nil {
+			return
+		}
+		header := make([]byte, 16)
+		binary.LittleEndian.PutUint32(header, uint32(len(img)))
+		// Header and frame go out as separate writes because the client
+		// recognises the header by its 16-byte read size.
+		if _, err := conn.Write(header); err != nil {
+			return
+		}
+		if _, err := conn.Write(img); err != nil {
+			return
+		}
+		time.Sleep(c.interval)
+	}
+}
+
+// cameraFrame renders a small solid-colour JPEG that changes with each frame.
+// Go's encoder omits the JFIF APP0 segment the printer's frames start with,
+// so it is inserted after the SOI marker.
+func cameraFrame(n int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	fill := color.RGBA{R: uint8(n * 40), G: 128, B: 200, A: 255}
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		return nil, err
+	}
+	encoded := buf.Bytes()
+	app0 := []byte{0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00}
+	out := make([]byte, 0, len(encoded)+len(app0))
+	out = append(out, encoded[:2]...)
+	out = append(out, app0...)
+	return append(out, encoded[2:]...), nil
+}
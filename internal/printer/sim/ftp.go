@@ -0,0 +1,413 @@
+package sim
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ftpServer is an implicit-FTPS server backed by a local directory. It
+// implements the commands the printer's FTP service and the jlaffaye/ftp
+// client rely on.
+type ftpServer struct {
+	root      string
+	host      string
+	username  string
+	password  string
+	tlsConfig *tls.Config
+	// dropAfter cuts a transfer's data connection once it reaches that
+	// offset in the file; a transfer resumed at or past it completes.
+	dropAfter int64
+	noSize    bool
+}
+
+func newFTPServer(root, host, username, password string, tlsConfig *tls.Config) *ftpServer {
+	return &ftpServer{root: root, host: host, username: username, password: password, tlsConfig: tlsConfig}
+}
+
+func (s *ftpServer) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+type ftpSession struct {
+	srv      *ftpServer
+	conn     net.Conn
+	r        *bufio.Reader
+	user     string
+	authed   bool
+	cwd      string
+	passive  net.Listener
+	offset   int64
+	renaming string
+}
+
+func (s *ftpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	sess := &ftpSession{srv: s, conn: conn, r: bufio.NewReader(conn), cwd: "/"}
+	defer sess.closePassive()
+	sess.reply(220, "bambu-cli simulator ready")
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := sess.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if !sess.dispatch(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (c *ftpSession) reply(code int, msg string) {
+	fmt.Fprintf(c.conn, "%d %s\r\n", code, msg)
+}
+
+// dispatch handles one command and reports whether the session continues.
+func (c *ftpSession) dispatch(cmd, arg string) bool {
+	switch cmd {
+	case "USER":
+		c.user = arg
+		c.reply(331, "Password required")
+		return true
+	case "PASS":
+		if c.user == c.srv.username && arg == c.srv.password {
+			c.authed = true
+			c.reply(230, "Logged in")
+		} else {
+			c.reply(530, "Login incorrect")
+		}
+		return true
+	case "QUIT":
+		c.reply(221, "Bye")
+		return false
+	case "FEAT":
+		fmt.Fprint(c.conn, "211-Features:\r\n UTF8\r\n SIZE\r\n MDTM\r\n REST STREAM\r\n MLST type*;size*;modify*;\r\n EPSV\r\n211 End\r\n")
+		return true
+	case "NOOP", "TYPE", "OPTS", "PBSZ", "PROT", "MODE", "STRU":
+		c.reply(200, "OK")
+		return true
+	}
+	if !c.authed {
+		c.reply(530, "Not logged in")
+		return true
+	}
+	switch cmd {
+	case "PWD", "XPWD":
+		c.reply(257, strconv.Quote(c.cwd))
+	case "CWD":
+		p := c.resolve(arg)
+		if info, err := os.Stat(c.local(p)); err != nil || !info.IsDir() {
+			c.reply(550, "No such directory")
+			return true
+		}
+		c.cwd = p
+		c.reply(250, "Directory changed")
+	case "CDUP":
+		c.cwd = path.Dir(c.cwd)
+		c.reply(250, "Directory changed")
+	case "EPSV":
+		port, err := c.openPassive()
+		if err != nil {
+			c.reply(425, err.Error())
+			return true
+		}
+		c.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+	case "PASV":
+		port, err := c.openPassive()
+		if err != nil {
+			c.reply(425, err.Error())
+			return true
+		}
+		ip := net.ParseIP(c.srv.host).To4()
+		if ip == nil {
+			ip = net.IPv4(127, 0, 0, 1).To4()
+		}
+		c.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xFF))
+	case "REST":
+		off, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || off < 0 {
+			c.reply(501, "Invalid offset")
+			return true
+		}
+		c.offset = off
+		c.reply(350, "Restarting at "+arg)
+	case "LIST", "NLST", "MLSD":
+		c.list(cmd, arg)
+	case "MLST":
+		info, err := os.Stat(c.local(c.resolve(arg)))
+		if err != nil {
+			c.reply(550, "No such file")
+			return true
+		}
+		fmt.Fprintf(c.conn, "250-Listing\r\n %s\r\n250 End\r\n", mlsxFacts(info, path.Base(c.resolve(arg))))
+	case "SIZE":
+		if c.srv.noSize {
+			c.reply(502, "Command not implemented")
+			return true
+		}
+		info, err := os.Stat(c.local(c.resolve(arg)))
+		if err != nil || info.IsDir() {
+			c.reply(550, "No such file")
+			return true
+		}
+		c.reply(213, strconv.FormatInt(info.Size(), 10))
+	case "MDTM":
+		info, err := os.Stat(c.local(c.resolve(arg)))
+		if err != nil {
+			c.reply(550, "No such file")
+			return true
+		}
+		c.reply(213, info.ModTime().UTC().Format("20060102150405"))
+	case "RETR":
+		c.retr(arg)
+	case "STOR", "APPE":
+		c.stor(arg, cmd == "APPE")
+	case "DELE":
+		if err := os.Remove(c.local(c.resolve(arg))); err != nil {
+			c.reply(550, "Delete failed")
+			return true
+		}
+		c.reply(250, "Deleted")
+	case "RNFR":
+		p := c.resolve(arg)
+		if _, err := os.Stat(c.local(p)); err != nil {
+			c.reply(550, "No such file")
+			return true
+		}
+		c.renaming = p
+		c.reply(350, "Ready for RNTO")
+	case "RNTO":
+		if c.renaming == "" {
+			c.reply(503, "RNFR required")
+			return true
+		}
+		err := os.Rename(c.local(c.renaming), c.local(c.resolve(arg)))
+		c.renaming = ""
+		if err != nil {
+			c.reply(550, "Rename failed")
+			return true
+		}
+		c.reply(250, "Renamed")
+	case "MKD":
+		if err := os.MkdirAll(c.local(c.resolve(arg)), 0o755); err != nil {
+			c.reply(550, "Create failed")
+			return true
+		}
+		c.reply(257, strconv.Quote(c.resolve(arg)))
+	case "RMD":
+		if err := os.Remove(c.local(c.resolve(arg))); err != nil {
+			c.reply(550, "Remove failed")
+			return true
+		}
+		c.reply(250, "Removed")
+	default:
+		c.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+// resolve returns the clean absolute FTP path for arg. Cleaning a rooted
+// path also keeps clients from escaping the served directory.
+func (c *ftpSession) resolve(arg string) string {
+	if arg == "" {
+		return c.cwd
+	}
+	if !strings.HasPrefix(arg, "/") {
+		arg = path.Join(c.cwd, arg)
+	}
+	return path.Clean("/" + arg)
+}
+
+func (c *ftpSession) local(p string) string {
+	return filepath.Join(c.srv.root, filepath.FromSlash(p))
+}
+
+func (c *ftpSession) openPassive() (int, error) {
+	c.closePassive()
+	ln, err := net.Listen("tcp", net.JoinHostPort(c.srv.host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	c.passive = ln
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (c *ftpSession) closePassive() {
+	if c.passive != nil {
+		_ = c.passive.Close()
+		c.passive = nil
+	}
+}
+
+// dataConn accepts the pending passive connection and wraps it in TLS, as
+// the printer protects data connections too (PROT P).
+func (c *ftpSession) dataConn() (net.Conn, error) {
+	if c.passive == nil {
+		return nil, fmt.Errorf("use EPSV or PASV first")
+	}
+	defer c.closePassive()
+	if tl, ok := c.passive.(*net.TCPListener); ok {
+		_ = tl.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+	conn, err := c.passive.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Server(conn, c.srv.tlsConfig), nil
+}
+
+func (c *ftpSession) list(cmd, arg string) {
+	// Clients sometimes pass ls-style flags; ignore them.
+	if strings.HasPrefix(arg, "-") {
+		arg = ""
+	}
+	dir := c.resolve(arg)
+	entries, err := os.ReadDir(c.local(dir))
+	if err != nil {
+		c.closePassive()
+		c.reply(550, "No such directory")
+		return
+	}
+	c.reply(150, "Opening data connection")
+	conn, err := c.dataConn()
+	if err != nil {
+		c.reply(425, err.Error())
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		switch cmd {
+		case "NLST":
+			fmt.Fprintf(conn, "%s\r\n", e.Name())
+		case "MLSD":
+			fmt.Fprintf(conn, "%s\r\n", mlsxFacts(info, e.Name()))
+		default:
+			fmt.Fprintf(conn, "%s\r\n", lsLine(info))
+		}
+	}
+	_ = conn.Close()
+	c.reply(226, "Transfer complete")
+}
+
+func (c *ftpSession) retr(arg string) {
+	offset := c.offset
+	c.offset = 0
+	f, err := os.Open(c.local(c.resolve(arg)))
+	if err != nil {
+		c.closePassive()
+		c.reply(550, "No such file")
+		return
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		c.closePassive()
+		c.reply(550, "Seek failed")
+		return
+	}
+	c.reply(150, "Opening data connection")
+	conn, err := c.dataConn()
+	if err != nil {
+		c.reply(425, err.Error())
+		return
+	}
+	if info, err := f.Stat(); err == nil && offset < c.srv.dropAfter && info.Size() > c.srv.dropAfter {
+		_, _ = io.CopyN(conn, f, c.srv.dropAfter-offset)
+		_ = conn.Close()
+		c.reply(426, "Connection dropped")
+		return
+	}
+	_, err = io.Copy(conn, f)
+	_ = conn.Close()
+	if err != nil {
+		c.reply(426, "Transfer aborted")
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+func (c *ftpSession) stor(arg string, appendMode bool) {
+	offset := c.offset
+	c.offset = 0
+	p := c.local(c.resolve(arg))
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case appendMode:
+		flags |= os.O_APPEND
+	case offset == 0:
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(p, flags, 0o644)
+	if err != nil {
+		c.closePassive()
+		c.reply(550, "Cannot create file")
+		return
+	}
+	defer f.Close()
+	if offset > 0 {
+		if err := f.Truncate(offset); err != nil {
+			c.closePassive()
+			c.reply(550, "Seek failed")
+			return
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			c.closePassive()
+			c.reply(550, "Seek failed")
+			return
+		}
+	}
+	c.reply(150, "Opening data connection")
+	conn, err := c.dataConn()
+	if err != nil {
+		c.reply(425, err.Error())
+		return
+	}
+	if offset < c.srv.dropAfter {
+		// Cut the upload if it runs past dropAfter.
+		if _, err := io.CopyN(f, conn, c.srv.dropAfter-offset); err != io.EOF {
+			_ = conn.Close()
+			c.reply(426, "Connection dropped")
+			return
+		}
+	}
+	_, err = io.Copy(f, conn)
+	_ = conn.Close()
+	if err != nil {
+		c.reply(426, "Transfer aborted")
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+func mlsxFacts(info os.FileInfo, name string) string {
+	typ := "file"
+	if info.IsDir() {
+		typ = "dir"
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=%s; %s", typ, info.Size(), info.ModTime().UTC().Format("20060102150405"), name)
+}
+
+func lsLine(info os.FileInfo) string {
+	mode := "-rw-r--r--"
+	if info.IsDir() {
+		mode = "drwxr-xr-x"
+	}
+	return fmt.Sprintf("%s 1 root root %d %s %s", mode, info.Size(), info.ModTime().UTC().Format("Jan _2 15:04"), info.Name())
+}
@@ -0,0 +1,523 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stagePrinting       = 0
+	stageBedLeveling    = 1
+	stageHeatbedPreheat = 2
+	stageFilamentRunout = 6
+	stageHeatingHotend  = 7
+	stagePausedUser     = 16
+	stageIdle           = 255
+
+	// errorCancelled is the print_error printers report after a stop.
+	errorCancelled = 0x0300400C
+	// errorRunout is reported while paused for an AMS A filament runout.
+	errorRunout = 0x07008011
+	// errorFailed is reported when a print fails at Config.FailAtLayer.
+	errorFailed = 0x03008000
+)
+
+// speedMagnitudes maps spd_lvl to the spd_mag percentage printers report.
+var speedMagnitudes = map[int]int{1: 50, 2: 100, 3: 124, 4: 166}
+
+// prepareStages are walked through, one per tick, before layers start.
+var prepareStages = []int{stageBedLeveling, stageHeatbedPreheat, stageHeatingHotend}
+
+type simTray struct {
+	id, name, typ, color, infoIdx string
+	remain                        int
+}
+
+// machine is the simulated printer. It applies commands from the request
+// topic, advances the print lifecycle on every tick and publishes reports:
+// a full report for pushall and only the changed fields otherwise, the way
+// P1/A1 printers do.
+type machine struct {
+	cfg     Config
+	publish func([]byte)
+
+	mu            sync.Mutex
+	gcodeState    string
+	stage         int
+	prepareStep   int
+	bedLeveling   bool
+	timelapse     bool
+	layer         int
+	file          string
+	subtask       string
+	printError    int
+	hms           []map[string]any
+	light         string
+	bed, bedT     float64
+	nozzle, nozT  float64
+	chamber       float64
+	pausedOnce    bool
+	skipped       []int
+	speed         int
+	trays         []simTray
+	dirtyTrays    map[int]bool
+	lastPublished map[string]any
+}
+
+func newMachine(cfg Config, publish func([]byte)) *machine {
+	return &machine{
+		cfg:        cfg,
+		publish:    publish,
+		gcodeState: "IDLE",
+		stage:      stageIdle,
+		light:      "on",
+		speed:      2,
+		bed:        25,
+		nozzle:     25,
+		chamber:    25,
+		trays: []simTray{
+			{"0", "A00-W1", "PLA", "FFFFFFFF", "GFA00", 80},
+			{"1", "A00-K0", "PLA", "000000FF", "GFA00", 65},
+			{"2", "G02-R0", "PETG", "C12E1FFF", "GFG02", 40},
+			{"3", "B00-D0", "ABS", "8E9089FF", "GFB00", 100},
+		},
+		dirtyTrays: map[int]bool{},
+	}
+}
+
+func (m *machine) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(m.cfg.Tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			m.step()
+			delta := m.deltaLocked()
+			m.mu.Unlock()
+			if delta != nil {
+				m.send(delta)
+			}
+		}
+	}
+}
+
+// step advances the lifecycle by one tick.
+func (m *machine) step() {
+	switch m.gcodeState {
+	case "PREPARE":
+		m.heat()
+		if m.prepareStep == 0 && !m.bedLeveling {
+			m.prepareStep++
+		}
+		if m.prepareStep < len(prepareStages) {
+			m.stage = prepareStages[m.prepareStep]
+			m.prepareStep++
+			return
+		}
+		m.gcodeState = "RUNNING"
+		m.stage = stagePrinting
+		m.layer = 1
+	case "RUNNING":
+		m.heat()
+		if m.layer >= m.cfg.Layers {
+			m.gcodeState = "FINISH"
+			m.stage = stageIdle
+			m.bedT, m.nozT = 0, 0
+			return
+		}
+		m.layer++
+		if m.layer%5 == 0 && m.trays[0].remain > 0 {
+			m.trays[0].remain--
+			m.dirtyTrays[0] = true
+		}
+		if m.cfg.PauseAtLayer > 0 && m.layer == m.cfg.PauseAtLayer && !m.pausedOnce {
+			m.pausedOnce = true
+			m.gcodeState = "PAUSE"
+			m.stage = stageFilamentRunout
+			m.printError = errorRunout
+			m.hms = []map[string]any{{"attr": 0x07002000, "code": 0x00020001}}
+			return
+		}
+		if m.cfg.FailAtLayer > 0 && m.layer == m.cfg.FailAtLayer {
+			m.gcodeState = "FAILED"
+			m.stage = stageIdle
+			m.printError = errorFailed
+			m.hms = []map[string]any{{"attr": 0x07002000, "code": 0x00020003}}
+			m.bedT, m.nozT = 0, 0
+		}
+	default:
+		m.heat()
+	}
+}
+
+// heat moves temperatures a step towards their targets, cooling to ambient
+// when the target is off.
+func (m *machine) heat() {
+	approach := func(cur, target, rate float64) float64 {
+		if target == 0 {
+			target = 25
+		}
+		if math.Abs(target-cur) <= rate {
+			return target
+		}
+		if target > cur {
+			return cur + rate
+		}
+		return cur - rate
+	}
+	m.bed = approach(m.bed, m.bedT, 10)
+	m.nozzle = approach(m.nozzle, m.nozT, 40)
+	if m.gcodeState == "RUNNING" {
+		m.chamber = approach(m.chamber, 35, 0.5)
+	} else {
+		m.chamber = approach(m.chamber, 25, 0.5)
+	}
+}
+
+var gcodeTemp = regexp.MustCompile(`^(M140|M104|M190|M109)\s+S(\d+)`)
+
+// handle applies a request payload and publishes the reply.
+func (m *machine) handle(payload []byte) {
+	var req map[string]map[string]any
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		return
+	}
+	if pushing, ok := req["pushing"]; ok && pushing["command"] == "pushall" {
+		m.mu.Lock()
+		full := m.fullLocked()
+		m.lastPublished = full
+		m.mu.Unlock()
+		report := copyMap(full)
+		report["command"] = "push_status"
+		report["msg"] = 0
+		if seq, ok := pushing["sequence_id"]; ok {
+			report["sequence_id"] = seq
+		}
+		m.send(report)
+		return
+	}
+	if sys, ok := req["system"]; ok {
+		command, _ := sys["command"].(string)
+		reply := map[string]any{"command": command, "sequence_id": sys["sequence_id"], "result": "success"}
+		m.mu.Lock()
+		switch command {
+		case "ledctrl":
+			if mode, ok := sys["led_mode"].(string); ok {
+				m.light = mode
+			}
+		case "reboot":
+			m.resetLocked()
+		default:
+			reply["result"], reply["reason"] = "fail", "unsupported command"
+		}
+		m.mu.Unlock()
+		m.sendSection("system", reply)
+		return
+	}
+	cmd, ok := req["print"]
+	if !ok {
+		return
+	}
+	command, _ := cmd["command"].(string)
+	m.mu.Lock()
+	reason := m.applyLocked(command, cmd)
+	m.mu.Unlock()
+
+	reply := map[string]any{"command": command, "sequence_id": cmd["sequence_id"], "result": "success"}
+	if param, ok := cmd["param"]; ok {
+		reply["param"] = param
+	}
+	if reason != "" {
+		reply["result"] = "fail"
+		reply["reason"] = reason
+	}
+	m.send(reply)
+}
+
+// applyLocked runs a print command and returns a rejection reason, if any.
+func (m *machine) applyLocked(command string, cmd map[string]any) string {
+	active := m.gcodeState == "PREPARE" || m.gcodeState == "RUNNING" || m.gcodeState == "PAUSE"
+	switch command {
+	case "project_file":
+		if active {
+			return "printer is busy"
+		}
+		file, _ := cmd["file"].(string)
+		if file == "" {
+			url, _ := cmd["url"].(string)
+			file = strings.TrimPrefix(url, "ftp://")
+		}
+		if _, err := os.Stat(filepath.Join(m.cfg.Dir, filepath.FromSlash(path.Clean("/"+file)))); err != nil {
+			return fmt.Sprintf("file not found: %s", file)
+		}
+		m.file = file
+		m.subtask = strings.TrimSuffix(path.Base(file), path.Ext(file))
+		m.gcodeState = "PREPARE"
+		m.prepareStep = 0
+		m.bedLeveling, _ = cmd["bed_leveling"].(bool)
+		m.timelapse, _ = cmd["timelapse"].(bool)
+		m.layer = 0
+		m.printError = 0
+		m.hms = nil
+		m.pausedOnce = false
+		m.skipped = intList(cmd["skip_objects"])
+		m.speed = 2
+		m.bedT, m.nozT = 60, 220
+	case "pause":
+		if m.gcodeState != "RUNNING" && m.gcodeState != "PREPARE" {
+			return "printer is not printing"
+		}
+		m.gcodeState = "PAUSE"
+		m.stage = stagePausedUser
+	case "resume":
+		if m.gcodeState != "PAUSE" {
+			return "printer is not paused"
+		}
+		m.gcodeState = "RUNNING"
+		m.stage = stagePrinting
+		m.printError = 0
+		m.hms = nil
+	case "stop":
+		if !active {
+			return "printer is not printing"
+		}
+		m.gcodeState = "FAILED"
+		m.stage = stageIdle
+		m.printError = errorCancelled
+		m.bedT, m.nozT = 0, 0
+	case "gcode_line":
+		param, _ := cmd["param"].(string)
+		for _, line := range strings.Split(param, "\n") {
+			match := gcodeTemp.FindStringSubmatch(strings.TrimSpace(line))
+			if match == nil {
+				continue
+			}
+			v, _ := strconv.ParseFloat(match[2], 64)
+			if match[1] == "M140" || match[1] == "M190" {
+				m.bedT = v
+			} else {
+				m.nozT = v
+			}
+		}
+	case "skip_objects":
+		if m.gcodeState != "RUNNING" && m.gcodeState != "PAUSE" {
+			return "printer is not printing"
+		}
+		for _, id := range intList(cmd["obj_list"]) {
+			if !slices.Contains(m.skipped, id) {
+				m.skipped = append(m.skipped, id)
+			}
+		}
+	case "print_speed":
+		if m.gcodeState != "RUNNING" && m.gcodeState != "PAUSE" {
+			return "printer is not printing"
+		}
+		param, _ := cmd["param"].(string)
+		level, err := strconv.Atoi(param)
+		if err != nil || speedMagnitudes[level] == 0 {
+			return fmt.Sprintf("invalid speed level %q", param)
+		}
+		m.speed = level
+	case "calibration":
+		if active {
+			return "printer is busy"
+		}
+	default:
+		return "unsupported command"
+	}
+	return ""
+}
+
+func (m *machine) resetLocked() {
+	m.gcodeState = "IDLE"
+	m.stage = stageIdle
+	m.file, m.subtask = "", ""
+	m.skipped = nil
+	m.file, m.subtask = "", ""
+	m.printError = 0
+	m.hms = nil
+	m.bedT, m.nozT = 0, 0
+}
+
+func (m *machine) fullLocked() map[string]any {
+	percent := m.layer * 100 / m.cfg.Layers
+	remaining := int(math.Ceil(float64(m.cfg.Layers-m.layer) * m.cfg.Tick.Seconds() / 60))
+	if m.gcodeState == "FINISH" {
+		percent = 100
+	}
+	hms := make([]any, 0, len(m.hms))
+	for _, h := range m.hms {
+		hms = append(hms, h)
+	}
+	return map[string]any{
+		"gcode_state":          m.gcodeState,
+		"stg_cur":              m.stage,
+		"mc_percent":           percent,
+		"mc_remaining_time":    remaining,
+		"layer_num":            m.layer,
+		"total_layer_num":      m.cfg.Layers,
+		"bed_temper":           m.bed,
+		"bed_target_temper":    m.bedT,
+		"nozzle_temper":        m.nozzle,
+		"nozzle_target_temper": m.nozT,
+		"chamber_temper":       m.chamber,
+		"cooling_fan_speed":    "0",
+		"big_fan1_speed":       "0",
+		"big_fan2_speed":       "0",
+		"heatbreak_fan_speed":  "0",
+		"spd_lvl":              m.speed,
+		"spd_mag":              speedMagnitudes[m.speed],
+		"gcode_file":           m.file,
+		"subtask_name":         m.subtask,
+		"s_obj":                append([]int{}, m.skipped...),
+		"print_error":          m.printError,
+		"wifi_signal":          "-42dBm",
+		"lights_report":        []any{map[string]any{"node": "chamber_light", "mode": m.light}},
+		"hms":                  hms,
+		"nozzle_diameter":      "0.4",
+		"nozzle_type":          "stainless_steel",
+		"home_flag":            0,
+		"sdcard":               true,
+		"ipcam": map[string]any{
+			"ipcam_dev":    "1",
+			"ipcam_record": "enable",
+			"timelapse":    enabled(m.timelapse),
+			"resolution":   "1080p",
+		},
+		"upgrade_state": map[string]any{
+			"status":            "IDLE",
+			"progress":          "0",
+			"message":           "",
+			"new_version_state": 2,
+		},
+		"ams": m.amsLocked(nil),
+	}
+}
+
+// amsLocked renders the AMS section. When only is non-nil, only those trays
+// are included, producing the partial update a P1 printer would send.
+func (m *machine) amsLocked(only map[int]bool) map[string]any {
+	trays := []any{}
+	for i, t := range m.trays {
+		if only != nil && !only[i] {
+			continue
+		}
+		if only != nil {
+			trays = append(trays, map[string]any{"id": t.id, "remain": t.remain})
+			continue
+		}
+		trays = append(trays, map[string]any{
+			"id":              t.id,
+			"tray_id_name":    t.name,
+			"tray_type":       t.typ,
+			"tray_sub_brands": t.typ + " Basic",
+			"tray_color":      t.color,
+			"tray_info_idx":   t.infoIdx,
+			"tray_weight":     "1000",
+			"tray_diameter":   "1.75",
+			"nozzle_temp_min": "190",
+			"nozzle_temp_max": "250",
+			"remain":          t.remain,
+		})
+	}
+	ams := map[string]any{
+		"ams": []any{map[string]any{"id": "0", "humidity": "4", "temp": "25.0", "tray": trays}},
+	}
+	if only == nil {
+		ams["ams_exist_bits"] = "1"
+		ams["tray_exist_bits"] = "f"
+		ams["tray_now"] = "0"
+	}
+	return ams
+}
+
+// deltaLocked returns the fields that changed since the last report, or nil.
+// Like the firmware, it marks a full report with "msg": 0 and a delta with
+// "msg": 1.
+func (m *machine) deltaLocked() map[string]any {
+	full := m.fullLocked()
+	if m.lastPublished == nil {
+		m.lastPublished = full
+		m.dirtyTrays = map[int]bool{}
+		report := copyMap(full)
+		report["command"], report["msg"] = "push_status", 0
+		return report
+	}
+	delta := map[string]any{}
+	for k, v := range full {
+		if k == "ams" {
+			continue
+		}
+		if !reflect.DeepEqual(m.lastPublished[k], v) {
+			delta[k] = v
+		}
+	}
+	if len(m.dirtyTrays) > 0 {
+		delta["ams"] = m.amsLocked(m.dirtyTrays)
+		m.dirtyTrays = map[int]bool{}
+	}
+	m.lastPublished = full
+	if len(delta) == 0 {
+		return nil
+	}
+	delta["command"], delta["msg"] = "push_status", 1
+	return delta
+}
+
+func (m *machine) send(print map[string]any) {
+	m.sendSection("print", print)
+}
+
+func (m *machine) sendSection(section string, body map[string]any) {
+	data, err := json.Marshal(map[string]any{section: body})
+	if err != nil {
+		return
+	}
+	m.publish(data)
+}
+
+func copyMap(in map[string]any) map[string]any {
+	out := make(map[string]any, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+// intList reads a JSON array of numbers decoded with UseNumber.
+func intList(v any) []int {
+	items, _ := v.([]any)
+	var out []int
+	for _, item := range items {
+		if n, ok := item.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				out = append(out, int(i))
+			}
+		}
+	}
+	return out
+}
+
+func enabled(on bool) string {
+	if on {
+		return "enable"
+	}
+	return "disable"
+}
@@ -0,0 +1,150 @@
+// Package sim runs a local stand-in for a Bambu Lab printer: a TLS MQTT
+// broker speaking the printer's report/request topics, an implicit-FTPS
+// server and a camera stream, driven by a scripted print lifecycle.
+package sim
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	Bind       string
+	Serial     string
+	AccessCode string
+	Username   string
+	MQTTPort   int
+	FTPPort    int
+	CameraPort int
+	// Dir holds the files served over FTPS. A temporary directory is used
+	// when empty.
+	Dir string
+	// Tick is the interval between lifecycle steps and reports.
+	Tick time.Duration
+	// Layers is the layer count of every simulated print.
+	Layers int
+	// PauseAtLayer pauses the print with a filament runout at that layer.
+	PauseAtLayer int
+	// FailAtLayer fails the print at that layer.
+	FailAtLayer int
+	// DropTransferAfter cuts FTP transfers after that many bytes of the
+	// file, to exercise resuming.
+	DropTransferAfter int64
+	// NoSize makes the FTPS server refuse SIZE, like servers that don't
+	// implement it.
+	NoSize bool
+}
+
+type Simulator struct {
+	cfg     Config
+	tempDir string
+	machine *machine
+	broker  *broker
+	ftp     *ftpServer
+	camera  *cameraServer
+	stop    chan struct{}
+}
+
+func New(cfg Config) (*Simulator, error) {
+	if cfg.Bind == "" {
+		cfg.Bind = "127.0.0.1"
+	}
+	if cfg.Serial == "" {
+		cfg.Serial = "SIM00000000001"
+	}
+	if cfg.AccessCode == "" {
+		return nil, errors.New("access code is required")
+	}
+	if cfg.Username == "" {
+		cfg.Username = "bblp"
+	}
+	if cfg.Tick <= 0 {
+		cfg.Tick = time.Second
+	}
+	if cfg.Layers <= 0 {
+		cfg.Layers = 20
+	}
+	return &Simulator{cfg: cfg, stop: make(chan struct{})}, nil
+}
+
+// Start opens all listeners and starts the lifecycle loop.
+func (s *Simulator) Start() error {
+	if s.cfg.Dir == "" {
+		dir, err := os.MkdirTemp("", "bambu-sim-*")
+		if err != nil {
+			return err
+		}
+		s.tempDir = dir
+		s.cfg.Dir = dir
+	}
+	cert, err := selfSignedCert(s.cfg.Serial, s.cfg.Bind)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	s.broker = newBroker(s.cfg.Serial, s.cfg.Username, s.cfg.AccessCode)
+	s.machine = newMachine(s.cfg, s.broker.publishReport)
+	s.broker.onRequest = s.machine.handle
+	s.ftp = newFTPServer(s.cfg.Dir, s.cfg.Bind, s.cfg.Username, s.cfg.AccessCode, tlsConfig)
+	s.ftp.dropAfter = s.cfg.DropTransferAfter
+	s.ftp.noSize = s.cfg.NoSize
+	s.camera = newCameraServer(s.cfg.Username, s.cfg.AccessCode, s.cfg.Tick)
+
+	listeners := []struct {
+		port  *int
+		serve func(net.Listener)
+	}{
+		{&s.cfg.MQTTPort, s.broker.serve},
+		{&s.cfg.FTPPort, s.ftp.serve},
+		{&s.cfg.CameraPort, s.camera.serve},
+	}
+	var opened []net.Listener
+	for _, l := range listeners {
+		ln, err := tls.Listen("tcp", net.JoinHostPort(s.cfg.Bind, strconv.Itoa(*l.port)), tlsConfig)
+		if err != nil {
+			for _, o := range opened {
+				_ = o.Close()
+			}
+			return err
+		}
+		// Port 0 picks a free port; report the one actually bound.
+		*l.port = ln.Addr().(*net.TCPAddr).Port
+		opened = append(opened, ln)
+		go l.serve(ln)
+	}
+	go func() {
+		<-s.stop
+		for _, o := range opened {
+			_ = o.Close()
+		}
+	}()
+	go s.machine.run(s.stop)
+	return nil
+}
+
+// Close stops the simulator and removes its temporary directory, if any.
+func (s *Simulator) Close() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	if s.tempDir != "" {
+		_ = os.RemoveAll(s.tempDir)
+	}
+}
+
+func (s *Simulator) Config() Config {
+	return s.cfg
+}
+
+func (s *Simulator) String() string {
+	return fmt.Sprintf("mqtt=%s:%d ftps=%s:%d camera=%s:%d serial=%s dir=%s",
+		s.cfg.Bind, s.cfg.MQTTPort, s.cfg.Bind, s.cfg.FTPPort, s.cfg.Bind, s.cfg.CameraPort, s.cfg.Serial, s.cfg.Dir)
+}
@@ -0,0 +1,378 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"bambu-cli/internal/printer"
+)
+
+const testAccessCode = "12345678"
+
+// startSim runs a simulator on free ports with a fast lifecycle.
+func startSim(t *testing.T, cfg Config) *Simulator {
+	t.Helper()
+	cfg.AccessCode = testAccessCode
+	cfg.Serial = "SIMTEST0000001"
+	cfg.Dir = t.TempDir()
+	if cfg.Tick == 0 {
+		cfg.Tick = 20 * time.Millisecond
+	}
+	if cfg.Layers == 0 {
+		cfg.Layers = 5
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// dial connects a client to s and waits for its first full report.
+func dial(t *testing.T, s *Simulator) *printer.MQTTClient {
+	t.Helper()
+	cfg := s.Config()
+	client, err := printer.NewMQTTClient(cfg.Bind, cfg.AccessCode, cfg.Serial, printer.MQTTOptions{
+		Port:    cfg.MQTTPort,
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	if err := client.PushAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WaitForData(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func ftpClient(s *Simulator) *printer.FTPClient {
+	cfg := s.Config()
+	return printer.NewFTPClient(cfg.Bind, cfg.AccessCode, "", cfg.FTPPort, 5*time.Second, nil)
+}
+
+// waitFor polls the client's status until cond holds.
+func waitFor(t *testing.T, client *printer.MQTTClient, what string, cond func(printer.Status) bool) printer.Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := printer.GetStatus(client)
+		if cond(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s; status %+v", what, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitForState(t *testing.T, client *printer.MQTTClient, state printer.GcodeState) printer.Status {
+	t.Helper()
+	return waitFor(t, client, string(state), func(s printer.Status) bool { return s.GcodeState == state })
+}
+
+func TestStatus(t *testing.T) {
+	s := startSim(t, Config{})
+	client := dial(t, s)
+
+	status := printer.GetStatus(client)
+	if status.GcodeState != printer.GcodeStateIdle {
+		t.Errorf("state = %s, want IDLE", status.GcodeState)
+	}
+	if len(client.Report().AMS.Units) == 0 {
+		t.Error("report has no AMS units")
+	}
+}
+
+func TestRequestReply(t *testing.T) {
+	s := startSim(t, Config{})
+	client := dial(t, s)
+
+	reply, err := client.Request(printer.PayloadLight(true), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Command != "ledctrl" || reply.SequenceID == "" {
+		t.Errorf("reply = %+v", reply)
+	}
+	next, err := client.Request(printer.PayloadLight(false), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.SequenceID == reply.SequenceID {
+		t.Errorf("sequence_id %s reused", next.SequenceID)
+	}
+	waitFor(t, client, "light off", func(s printer.Status) bool { return s.Light == "off" })
+
+	_, err = client.Request(printer.PayloadPrintPause(), 5*time.Second)
+	var cmdErr *printer.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Command != "pause" {
+		t.Fatalf("pause while idle: err = %v, want a rejection", err)
+	}
+}
+
+func TestPrintLifecycle(t *testing.T) {
+	s := startSim(t, Config{Layers: 200})
+	client := dial(t, s)
+	events, unsubscribe := client.Subscribe(256)
+	defer unsubscribe()
+
+	if err := ftpClient(s).UploadReader(bytes.NewReader([]byte("3mf")), "/job.3mf"); err != nil {
+		t.Fatal(err)
+	}
+	start := printer.PayloadStartPrint(printer.StartPrintOptions{Filename: "job.3mf", PlateLocation: "Metadata/plate_1.gcode"})
+	if _, err := client.Request(start, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	status := waitForState(t, client, printer.GcodeStateRunning)
+	if status.File != "job.3mf" {
+		t.Errorf("file = %q", status.File)
+	}
+
+	if _, err := client.Request(printer.PayloadPrintPause(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, client, printer.GcodeStatePause)
+	if _, err := client.Request(printer.PayloadPrintResume(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, client, printer.GcodeStateRunning)
+	if _, err := client.Request(printer.PayloadPrintStop(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	status = waitForState(t, client, printer.GcodeStateFailed)
+	if status.ErrorCode != printer.PrintErrorCancelled {
+		t.Errorf("error code = %#x, want cancelled", status.ErrorCode)
+	}
+
+	var states []printer.GcodeState
+	for len(events) > 0 {
+		if ev := <-events; ev.Type == printer.EventStateChanged {
+			states = append(states, ev.State)
+		}
+	}
+	want := []printer.GcodeState{printer.GcodeStatePrepare, printer.GcodeStateRunning, printer.GcodeStatePause, printer.GcodeStateRunning, printer.GcodeStateFailed}
+	if !slices.Equal(states, want) {
+		t.Errorf("state events = %v, want %v", states, want)
+	}
+}
+
+func TestPrintFinishes(t *testing.T) {
+	s := startSim(t, Config{Layers: 3})
+	client := dial(t, s)
+	if err := os.WriteFile(filepath.Join(s.Config().Dir, "job.3mf"), []byte("3mf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	start := printer.PayloadStartPrint(printer.StartPrintOptions{Filename: "job.3mf"})
+	if _, err := client.Request(start, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	status := waitForState(t, client, printer.GcodeStateFinish)
+	if status.LayerCurrent != 3 || status.Percent != 100 {
+		t.Errorf("finished at layer %d, %d%%", status.LayerCurrent, status.Percent)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	s := startSim(t, Config{})
+	ftp := ftpClient(s)
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	local := filepath.Join(t.TempDir(), "part.3mf")
+	if err := os.WriteFile(local, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ftp.Upload(local, "/part.3mf"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ftp.List("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "part.3mf" || files[0].Size != int64(len(content)) {
+		t.Fatalf("list = %+v", files)
+	}
+
+	var got bytes.Buffer
+	if err := ftp.Download("/part.3mf", &got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), content) {
+		t.Errorf("downloaded %d bytes, want %d", got.Len(), len(content))
+	}
+
+	if err := ftp.Delete("/part.3mf"); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := ftp.List("/"); err != nil || len(files) != 0 {
+		t.Errorf("after delete: list = %+v, err = %v", files, err)
+	}
+}
+
+func TestFilesResumeDroppedTransfers(t *testing.T) {
+	s := startSim(t, Config{DropTransferAfter: 4096})
+	ftp := ftpClient(s)
+	var retries int
+	ftp.SetProgress(func(p printer.TransferProgress) {
+		if p.Retry != nil {
+			retries++
+		}
+	})
+	content := bytes.Repeat([]byte("abcdefgh"), 2048)
+	local := filepath.Join(t.TempDir(), "big.3mf")
+	if err := os.WriteFile(local, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ftp.Upload(local, "/big.3mf"); err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := ftp.Download("/big.3mf", &got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), content) {
+		t.Errorf("downloaded %d bytes, want %d", got.Len(), len(content))
+	}
+	if retries == 0 {
+		t.Error("transfers were not interrupted")
+	}
+}
+
+func TestDownloadFileResumesPart(t *testing.T) {
+	s := startSim(t, Config{DropTransferAfter: 4096})
+	ftp := ftpClient(s)
+	content := bytes.Repeat([]byte("abcdefgh"), 2048)
+	if err := os.WriteFile(filepath.Join(s.Config().Dir, "big.3mf"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// What an earlier, interrupted download left behind.
+	local := filepath.Join(t.TempDir(), "big.3mf")
+	if err := os.WriteFile(local+".part", content[:1000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ftp.DownloadFile("/big.3mf", local); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, want %d", len(got), len(content))
+	}
+	if _, err := os.Stat(local + ".part"); !os.IsNotExist(err) {
+		t.Errorf("part file left behind: %v", err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.3mf")
+	if err := ftp.DownloadFile("/missing.3mf", missing); err == nil {
+		t.Error("download of a missing file succeeded")
+	}
+	if _, err := os.Stat(missing + ".part"); !os.IsNotExist(err) {
+		t.Errorf("empty part file left behind: %v", err)
+	}
+}
+
+func TestDownloadWithoutSize(t *testing.T) {
+	s := startSim(t, Config{NoSize: true})
+	ftp := ftpClient(s)
+	var totals []int64
+	ftp.SetProgress(func(p printer.TransferProgress) { totals = append(totals, p.Total) })
+	content := bytes.Repeat([]byte("abcdefgh"), 2048)
+	if err := os.WriteFile(filepath.Join(s.Config().Dir, "big.3mf"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A part file can't be resumed without the size; it is started over.
+	local := filepath.Join(t.TempDir(), "big.3mf")
+	if err := os.WriteFile(local+".part", []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ftp.DownloadFile("/big.3mf", local); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, want %d", len(got), len(content))
+	}
+	if len(totals) == 0 || slices.ContainsFunc(totals, func(n int64) bool { return n >= 0 }) {
+		t.Errorf("progress totals = %v, want all -1", totals)
+	}
+}
+
+func TestDroppedDownloadWithoutSizeIsNotRetried(t *testing.T) {
+	s := startSim(t, Config{NoSize: true, DropTransferAfter: 4096})
+	ftp := ftpClient(s)
+	var retries int
+	ftp.SetProgress(func(p printer.TransferProgress) {
+		if p.Retry != nil {
+			retries++
+		}
+	})
+	content := bytes.Repeat([]byte("abcdefgh"), 2048)
+	if err := os.WriteFile(filepath.Join(s.Config().Dir, "big.3mf"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(t.TempDir(), "big.3mf")
+	if err := ftp.DownloadFile("/big.3mf", local); err == nil {
+		t.Fatal("cut download succeeded")
+	}
+	if retries != 0 {
+		t.Errorf("retried %d times", retries)
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Errorf("cut download saved under the real name: %v", err)
+	}
+}
+
+func TestRecorderCapturesFirstReport(t *testing.T) {
+	s := startSim(t, Config{})
+	cfg := s.Config()
+	var buf bytes.Buffer
+	recorder := printer.NewRecorder(&buf)
+	client, err := printer.NewMQTTClient(cfg.Bind, cfg.AccessCode, cfg.Serial, printer.MQTTOptions{
+		Port:     cfg.MQTTPort,
+		Timeout:  5 * time.Second,
+		Recorder: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PushAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WaitForData(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if recorder.Count() == 0 {
+		t.Fatal("no reports recorded")
+	}
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := printer.NewReplayClient(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := printer.GetStatus(replay).GcodeState; got != printer.GcodeStateIdle {
+		t.Errorf("replayed state = %s, want IDLE", got)
+	}
+}
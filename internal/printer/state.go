@@ -0,0 +1,148 @@
+package printer
+
+import "sync"
+
+// State reconciles the full and partial reports a printer sends into one
+// document. P1/A1 printers only send the fields that changed, so nested
+// objects are merged recursively and, in partial reports, arrays of objects
+// are merged element by element using their "id" field. Arrays in a full
+// report replace the cached ones, so removed AMS units and trays go away.
+type State struct {
+	mu     sync.RWMutex
+	data   map[string]any
+	report PrintReport
+}
+
+func NewState() *State {
+	return &State{data: map[string]any{}}
+}
+
+// Apply merges a decoded report into the state. The typed report is rebuilt
+// once here, when the "print" section changes, rather than on every read.
+func (s *State) Apply(doc map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mergeMaps(s.data, doc, isFullReport(doc))
+	if _, ok := doc["print"]; ok {
+		s.report, _ = DecodePrintReport(s.data["print"])
+	}
+}
+
+// Snapshot returns a deep copy of the current state.
+func (s *State) Snapshot() map[string]any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return deepCopy(s.data).(map[string]any)
+}
+
+// HasReport reports whether a "print" section has been applied, i.e.
+// whether there is a baseline to compare later reports against.
+func (s *State) HasReport() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.data["print"]
+	return ok
+}
+
+// Report returns the typed "print" section of the state. The report shares
+// its slices and maps with later calls, so callers must not modify them.
+func (s *State) Report() PrintReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.report
+}
+
+// isFullReport reports whether doc is a complete status report rather than
+// a delta. Printers mark full push_status reports with "msg": 0.
+func isFullReport(doc map[string]any) bool {
+	section, ok := doc["print"].(map[string]any)
+	if !ok || stringField(section["command"]) != "push_status" {
+		return false
+	}
+	msg, ok := section["msg"]
+	return ok && stringField(msg) == "0"
+}
+
+func mergeMaps(dst, src map[string]any, full bool) {
+	for k, v := range src {
+		dst[k] = mergeValue(dst[k], v, full)
+	}
+}
+
+func mergeValue(existing, update any, full bool) any {
+	switch u := update.(type) {
+	case map[string]any:
+		if e, ok := existing.(map[string]any); ok {
+			mergeMaps(e, u, full)
+			return e
+		}
+		return deepCopy(u)
+	case []any:
+		if e, ok := existing.([]any); ok && !full {
+			if merged, ok := mergeByID(e, u); ok {
+				return merged
+			}
+		}
+		return deepCopy(u)
+	default:
+		return update
+	}
+}
+
+// mergeByID merges two arrays whose elements are all objects carrying an
+// "id". Elements present in update are merged into the matching existing
+// element or appended; existing elements missing from update are kept, as
+// a partial report only lists what changed. It reports false if either
+// array is not keyed by id.
+func mergeByID(existing, update []any) ([]any, bool) {
+	if len(update) == 0 || !keyedByID(existing) || !keyedByID(update) {
+		return nil, false
+	}
+	index := make(map[string]int, len(existing))
+	for i, el := range existing {
+		index[stringField(el.(map[string]any)["id"])] = i
+	}
+	for _, el := range update {
+		obj := el.(map[string]any)
+		id := stringField(obj["id"])
+		if i, ok := index[id]; ok {
+			mergeMaps(existing[i].(map[string]any), obj, false)
+			continue
+		}
+		index[id] = len(existing)
+		existing = append(existing, deepCopy(obj))
+	}
+	return existing, true
+}
+
+func keyedByID(arr []any) bool {
+	for _, el := range arr {
+		obj, ok := el.(map[string]any)
+		if !ok {
+			return false
+		}
+		if _, ok := obj["id"]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func deepCopy(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, vv := range t {
+			out[k] = deepCopy(vv)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, vv := range t {
+			out[i] = deepCopy(vv)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,98 @@
+package printer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStateApplyArrays(t *testing.T) {
+	const twoUnits = `{"print":{"command":"push_status","msg":0,"ams":{"ams":[
+		{"id":"0","humidity":"4","tray":[{"id":"0","tray_type":"PLA"},{"id":"1","tray_type":"PETG"}]},
+		{"id":"1","humidity":"3","tray":[{"id":"0","tray_type":"ABS"}]}]}}}`
+
+	tests := []struct {
+		name   string
+		update string
+		want   string
+	}{
+		{
+			name:   "delta merges matching element",
+			update: `{"print":{"command":"push_status","msg":1,"ams":{"ams":[{"id":"0","tray":[{"id":"1","remain":40}]}]}}}`,
+			want: `[{"id":"0","humidity":"4","tray":[{"id":"0","tray_type":"PLA"},{"id":"1","tray_type":"PETG","remain":40}]},
+				{"id":"1","humidity":"3","tray":[{"id":"0","tray_type":"ABS"}]}]`,
+		},
+		{
+			name:   "delta appends new element",
+			update: `{"print":{"command":"push_status","msg":1,"ams":{"ams":[{"id":"2","humidity":"5"}]}}}`,
+			want: `[{"id":"0","humidity":"4","tray":[{"id":"0","tray_type":"PLA"},{"id":"1","tray_type":"PETG"}]},
+				{"id":"1","humidity":"3","tray":[{"id":"0","tray_type":"ABS"}]},{"id":"2","humidity":"5"}]`,
+		},
+		{
+			name:   "delta without msg merges",
+			update: `{"print":{"ams":{"ams":[{"id":"1","humidity":"2"}]}}}`,
+			want: `[{"id":"0","humidity":"4","tray":[{"id":"0","tray_type":"PLA"},{"id":"1","tray_type":"PETG"}]},
+				{"id":"1","humidity":"2","tray":[{"id":"0","tray_type":"ABS"}]}]`,
+		},
+		{
+			name:   "full report drops removed unit",
+			update: `{"print":{"command":"push_status","msg":0,"ams":{"ams":[{"id":"0","humidity":"4","tray":[{"id":"0","tray_type":"PLA"},{"id":"1","tray_type":"PETG"}]}]}}}`,
+			want:   `[{"id":"0","humidity":"4","tray":[{"id":"0","tray_type":"PLA"},{"id":"1","tray_type":"PETG"}]}]`,
+		},
+		{
+			name:   "full report drops removed tray",
+			update: `{"print":{"command":"push_status","msg":0,"ams":{"ams":[{"id":"0","tray":[{"id":"0","tray_type":"PLA"}]},{"id":"1","tray":[{"id":"0","tray_type":"ABS"}]}]}}}`,
+			want:   `[{"id":"0","tray":[{"id":"0","tray_type":"PLA"}]},{"id":"1","tray":[{"id":"0","tray_type":"ABS"}]}]`,
+		},
+		{
+			name:   "empty array replaces",
+			update: `{"print":{"command":"push_status","msg":1,"ams":{"ams":[]}}}`,
+			want:   `[]`,
+		},
+		{
+			name:   "array without ids replaces",
+			update: `{"print":{"command":"push_status","msg":1,"ams":{"ams":["a"]}}}`,
+			want:   `["a"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewState()
+			s.Apply(decodeDoc(t, twoUnits))
+			s.Apply(decodeDoc(t, tt.update))
+			got := s.Snapshot()["print"].(map[string]any)["ams"].(map[string]any)["ams"]
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(normalize(t, got), want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Fatalf("ams = %s\nwant %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
+
+func decodeDoc(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(s), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// normalize round-trips v through JSON so it compares equal to a decoded
+// expectation.
+func normalize(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
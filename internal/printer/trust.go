@@ -0,0 +1,120 @@
+package printer
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Trust describes how a printer's TLS certificate is verified. Printers
+// present a self-signed or Bambu-CA-issued certificate whose names never
+// match their LAN address, so normal hostname verification cannot be used.
+// With neither field set any certificate is accepted.
+type Trust struct {
+	// Fingerprint is the pinned SHA-256 of the leaf certificate, hex encoded.
+	Fingerprint string
+	// Roots, when set, must issue the leaf certificate, and its common name
+	// must equal Serial.
+	Roots  *x509.CertPool
+	Serial string
+}
+
+// FingerprintMismatchError reports a certificate that differs from the pin.
+type FingerprintMismatchError struct {
+	Expected string
+	Got      string
+}
+
+func (e *FingerprintMismatchError) Error() string {
+	return fmt.Sprintf("printer certificate fingerprint %s does not match pinned %s", e.Got, e.Expected)
+}
+
+// TLSConfig returns the client TLS configuration enforcing t.
+func (t Trust) TLSConfig() *tls.Config {
+	return &tls.Config{
+		// Verification is done in VerifyConnection; the default hostname
+		// check would always fail against a printer.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return t.Verify(cs.PeerCertificates)
+		},
+	}
+}
+
+// Verify checks a presented certificate chain, leaf first.
+func (t Trust) Verify(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("printer presented no certificate")
+	}
+	leaf := chain[0]
+	if t.Fingerprint != "" {
+		got := CertFingerprint(leaf)
+		if got != NormalizeFingerprint(t.Fingerprint) {
+			return &FingerprintMismatchError{Expected: NormalizeFingerprint(t.Fingerprint), Got: got}
+		}
+	}
+	if t.Roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range chain[1:] {
+			intermediates.AddCert(c)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: t.Roots, Intermediates: intermediates}); err != nil {
+			return fmt.Errorf("printer certificate not issued by the configured CA: %w", err)
+		}
+		if t.Serial != "" && leaf.Subject.CommonName != t.Serial {
+			return fmt.Errorf("printer certificate is for %q, expected serial %q", leaf.Subject.CommonName, t.Serial)
+		}
+	}
+	return nil
+}
+
+// CertFingerprint returns the lowercase hex SHA-256 of the certificate.
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint accepts fingerprints in the common colon-separated,
+// upper or lower case forms.
+func NormalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(strings.TrimSpace(fp)))
+}
+
+// LoadCertPool reads PEM certificates from path.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return pool, nil
+}
+
+// ProbeCertificate connects to addr without verification and returns the
+// certificate chain the printer presents.
+func ProbeCertificate(addr string, timeout time.Duration) ([]*x509.Certificate, error) {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	chain := conn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, errors.New("printer presented no certificate")
+	}
+	return chain, nil
+}
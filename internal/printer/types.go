@@ -1,6 +1,10 @@
 package printer
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type PrintStatus int
 
@@ -152,3 +156,39 @@ func ParsePrintStatus(v any) (PrintStatus, error) {
 type jsonNumber interface {
 	Int64() (int64, error)
 }
+
+// SpeedLevel is a print speed profile, as in spd_lvl and the print_speed
+// command.
+type SpeedLevel int
+
+const (
+	SpeedSilent    SpeedLevel = 1
+	SpeedStandard  SpeedLevel = 2
+	SpeedSport     SpeedLevel = 3
+	SpeedLudicrous SpeedLevel = 4
+)
+
+var speedLevelNames = map[SpeedLevel]string{
+	SpeedSilent:    "silent",
+	SpeedStandard:  "standard",
+	SpeedSport:     "sport",
+	SpeedLudicrous: "ludicrous",
+}
+
+func (l SpeedLevel) String() string {
+	if name, ok := speedLevelNames[l]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseSpeedLevel accepts a profile name or its number (1-4).
+func ParseSpeedLevel(s string) (SpeedLevel, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for level, name := range speedLevelNames {
+		if s == name || s == strconv.Itoa(int(level)) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown speed %q (want silent, standard, sport or ludicrous)", s)
+}
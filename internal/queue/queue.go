@@ -0,0 +1,68 @@
+// Package queue stores print jobs waiting to be started, in queue.json under
+// the user config directory.
+package queue
+
+import (
+	"time"
+
+	"bambu-cli/internal/store"
+)
+
+// Job is a queued print start.
+type Job struct {
+	ID      int    `json:"id"`
+	File    string `json:"file"`
+	Plate   string `json:"plate,omitempty"`
+	Printer string `json:"printer,omitempty"`
+	// Options are further print start flags, stored as given.
+	Options []string  `json:"options,omitempty"`
+	Added   time.Time `json:"added"`
+}
+
+type Queue struct {
+	store.Sequence
+	Jobs []Job `json:"jobs"`
+}
+
+// Read loads the queue; a missing file is an empty queue.
+func Read(path string) (Queue, error) {
+	var q Queue
+	err := store.Read(path, &q)
+	return q, err
+}
+
+// Save writes the queue (see store.Write).
+func Save(path string, q Queue) error {
+	if q.Jobs == nil {
+		q.Jobs = []Job{}
+	}
+	return store.Write(path, q)
+}
+
+// Add appends a job and assigns its ID.
+func (q *Queue) Add(job Job) Job {
+	job.ID = q.NewID()
+	q.Jobs = append(q.Jobs, job)
+	return job
+}
+
+// Remove deletes the job with the given ID and reports whether it existed.
+func (q *Queue) Remove(id int) bool {
+	for i, j := range q.Jobs {
+		if j.ID == id {
+			q.Jobs = append(q.Jobs[:i], q.Jobs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the oldest job for printer.
+func (q *Queue) Next(printer string) (Job, bool) {
+	for _, j := range q.Jobs {
+		if j.Printer == printer {
+			return j, true
+		}
+	}
+	return Job{}, false
+}
@@ -0,0 +1,67 @@
+// Package store reads and writes bambu-cli's JSON data files, such as the
+// print queue and history.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Read decodes the JSON file at path into v. A missing file leaves v as it
+// is.
+func Read(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Write writes v as indented JSON to path through a temporary file in the
+// same directory, so a concurrent reader never sees it half written and two
+// writers never share a temporary file.
+func Write(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Sequence hands out the IDs of a file's entries. Embed it in the stored
+// document so the next ID is saved with it.
+type Sequence struct {
+	NextID int `json:"next_id"`
+}
+
+// NewID returns an unused ID.
+func (s *Sequence) NewID() int {
+	if s.NextID < 1 {
+		s.NextID = 1
+	}
+	id := s.NextID
+	s.NextID++
+	return id
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type document struct {
+	Sequence
+	Names []string `json:"names"`
+}
+
+func TestWriteRead(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "bambu")
+	path := filepath.Join(dir, "queue.json")
+
+	var doc document
+	if err := Read(path, &doc); err != nil {
+		t.Fatalf("reading a missing file: %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		doc.Names = append(doc.Names, name)
+		doc.NewID()
+		if err := Write(path, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"next_id\": 3,\n  \"names\": [\n    \"a\",\n    \"b\"\n  ]\n}\n"
+	if string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+	var got document
+	if err := Read(path, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.NextID != 3 || len(got.Names) != 2 {
+		t.Errorf("read %+v", got)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only queue.json", len(entries))
+	}
+}
+
+func TestSequenceStartsAtOne(t *testing.T) {
+	var s Sequence
+	if a, b := s.NewID(), s.NewID(); a != 1 || b != 2 {
+		t.Errorf("IDs = %d, %d; want 1, 2", a, b)
+	}
+}
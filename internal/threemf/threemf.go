@@ -0,0 +1,442 @@
+// Package threemf reads the Bambu Studio metadata embedded in sliced 3MF
+// project files: per-plate slice results, object labels, filament usage and
+// the project settings the job was sliced with.
+package threemf
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Project is the inspected content of a 3MF file.
+type Project struct {
+	SlicerVersion  string    `json:"slicer_version,omitempty"`
+	PrinterModel   string    `json:"printer_model,omitempty"`
+	NozzleDiameter float64   `json:"nozzle_diameter,omitempty"`
+	BedType        string    `json:"bed_type,omitempty"`
+	Plates         []Plate   `json:"plates"`
+	Thumbnails     []string  `json:"thumbnails,omitempty"`
+	Settings       *Settings `json:"-"`
+}
+
+// Plate is one build plate. Objects and filaments are only known for plates
+// that have been sliced.
+type Plate struct {
+	Index          int        `json:"index"`
+	Name           string     `json:"name,omitempty"`
+	GcodeFile      string     `json:"gcode_file,omitempty"`
+	GcodeMD5       string     `json:"gcode_md5,omitempty"`
+	Sliced         bool       `json:"sliced"`
+	PrinterModelID string     `json:"printer_model_id,omitempty"`
+	PredictionSec  int        `json:"prediction_seconds,omitempty"`
+	WeightGrams    float64    `json:"weight_grams,omitempty"`
+	NozzleDiameter float64    `json:"nozzle_diameter,omitempty"`
+	BedType        string     `json:"bed_type,omitempty"`
+	Objects        []Object   `json:"objects"`
+	Filaments      []Filament `json:"filaments"`
+	Thumbnail      string     `json:"thumbnail,omitempty"`
+}
+
+// Object is a printable object on a plate. ID is the identify_id the printer
+// uses for skip_objects.
+type Object struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// Filament is a filament slot used by a plate. ID is the 1-based slot in the
+// project's filament list.
+type Filament struct {
+	ID          int     `json:"id"`
+	Type        string  `json:"type"`
+	Color       string  `json:"color"`
+	TrayInfoIdx string  `json:"tray_info_idx,omitempty"`
+	UsedMeters  float64 `json:"used_m,omitempty"`
+	UsedGrams   float64 `json:"used_g,omitempty"`
+}
+
+// Settings holds the project settings (Metadata/project_settings.config), a
+// flat JSON object of slicer options whose values are strings or string
+// arrays.
+type Settings struct {
+	values map[string]json.RawMessage
+}
+
+// String returns a scalar setting, or the first element of an array setting.
+func (s *Settings) String(key string) string {
+	if s == nil {
+		return ""
+	}
+	raw, ok := s.values[key]
+	if !ok {
+		return ""
+	}
+	var v string
+	if json.Unmarshal(raw, &v) == nil {
+		return v
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil && len(list) > 0 {
+		return list[0]
+	}
+	return ""
+}
+
+// Strings returns an array setting; a scalar is returned as one element.
+func (s *Settings) Strings(key string) []string {
+	if s == nil {
+		return nil
+	}
+	raw, ok := s.values[key]
+	if !ok {
+		return nil
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+	var v string
+	if json.Unmarshal(raw, &v) == nil {
+		return []string{v}
+	}
+	return nil
+}
+
+// Plate returns the plate with the given 1-based index.
+func (p *Project) Plate(index int) (*Plate, bool) {
+	for i := range p.Plates {
+		if p.Plates[i].Index == index {
+			return &p.Plates[i], true
+		}
+	}
+	return nil, false
+}
+
+// Open inspects the 3MF file at path.
+func Open(path string) (*Project, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, info.Size())
+}
+
+// Read inspects a 3MF archive.
+func Read(r io.ReaderAt, size int64) (*Project, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a 3MF archive: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	proj := &Project{}
+	if f, ok := files["Metadata/project_settings.config"]; ok {
+		var values map[string]json.RawMessage
+		if err := readJSON(f, &values); err != nil {
+			return nil, fmt.Errorf("project_settings.config: %w", err)
+		}
+		proj.Settings = &Settings{values: values}
+		proj.PrinterModel = studioModel(proj.Settings.String("printer_model"))
+		proj.NozzleDiameter = parseFloat(proj.Settings.String("nozzle_diameter"))
+		proj.BedType = BedTypeID(proj.Settings.String("curr_bed_type"))
+	}
+
+	plates := map[int]*Plate{}
+	plate := func(index int) *Plate {
+		if p, ok := plates[index]; ok {
+			return p
+		}
+		p := &Plate{Index: index, Objects: []Object{}, Filaments: []Filament{}}
+		plates[index] = p
+		return p
+	}
+
+	if f, ok := files["Metadata/model_settings.config"]; ok {
+		var ms modelSettings
+		if err := readXML(f, &ms); err != nil {
+			return nil, fmt.Errorf("model_settings.config: %w", err)
+		}
+		names := map[string]string{}
+		for _, o := range ms.Objects {
+			names[o.ID] = metadata(o.Metadata, "name")
+		}
+		for _, mp := range ms.Plates {
+			index, err := strconv.Atoi(metadata(mp.Metadata, "plater_id"))
+			if err != nil {
+				continue
+			}
+			p := plate(index)
+			p.Name = metadata(mp.Metadata, "plater_name")
+			p.GcodeFile = metadata(mp.Metadata, "gcode_file")
+			p.Thumbnail = metadata(mp.Metadata, "thumbnail_file")
+			for _, inst := range mp.Instances {
+				id, err := strconv.Atoi(metadata(inst.Metadata, "identify_id"))
+				if err != nil {
+					continue
+				}
+				p.Objects = append(p.Objects, Object{ID: id, Name: names[metadata(inst.Metadata, "object_id")]})
+			}
+		}
+	}
+
+	if f, ok := files["Metadata/slice_info.config"]; ok {
+		var si sliceInfo
+		if err := readXML(f, &si); err != nil {
+			return nil, fmt.Errorf("slice_info.config: %w", err)
+		}
+		for _, h := range si.Header {
+			if h.Key == "X-BBL-Client-Version" {
+				proj.SlicerVersion = h.Value
+			}
+		}
+		for _, sp := range si.Plates {
+			index, err := strconv.Atoi(metadata(sp.Metadata, "index"))
+			if err != nil {
+				continue
+			}
+			p := plate(index)
+			p.Sliced = true
+			p.PrinterModelID = metadata(sp.Metadata, "printer_model_id")
+			p.PredictionSec, _ = strconv.Atoi(metadata(sp.Metadata, "prediction"))
+			p.WeightGrams = parseFloat(metadata(sp.Metadata, "weight"))
+			p.NozzleDiameter = parseFloat(metadata(sp.Metadata, "nozzle_diameters"))
+			// slice_info lists the objects actually in the sliced gcode; it
+			// is authoritative over model_settings when present.
+			if len(sp.Objects) > 0 {
+				p.Objects = p.Objects[:0]
+				for _, o := range sp.Objects {
+					p.Objects = append(p.Objects, Object{ID: o.ID, Name: o.Name, Skipped: o.Skipped == "true"})
+				}
+			}
+			for _, fl := range sp.Filaments {
+				p.Filaments = append(p.Filaments, Filament{
+					ID:          fl.ID,
+					Type:        fl.Type,
+					Color:       fl.Color,
+					TrayInfoIdx: fl.TrayInfoIdx,
+					UsedMeters:  parseFloat(fl.UsedM),
+					UsedGrams:   parseFloat(fl.UsedG),
+				})
+			}
+		}
+	}
+
+	for name, f := range files {
+		m := plateJSONName.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(m[1])
+		var pj plateJSON
+		if err := readJSON(f, &pj); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		p := plate(index)
+		p.BedType = BedTypeID(pj.BedType)
+		if p.NozzleDiameter == 0 {
+			p.NozzleDiameter = pj.NozzleDiameter
+		}
+		if len(p.Objects) == 0 {
+			for _, o := range pj.Objects {
+				p.Objects = append(p.Objects, Object{ID: o.ID, Name: o.Name})
+			}
+		}
+	}
+
+	for index, p := range plates {
+		if p.GcodeFile == "" {
+			p.GcodeFile = fmt.Sprintf("Metadata/plate_%d.gcode", index)
+		}
+		if _, ok := files[p.GcodeFile]; ok {
+			p.Sliced = true
+		}
+		if f, ok := files[p.GcodeFile+".md5"]; ok {
+			if sum, err := readAll(f); err == nil {
+				p.GcodeMD5 = strings.ToUpper(strings.TrimSpace(string(sum)))
+			}
+		}
+		if p.BedType == "" {
+			p.BedType = proj.BedType
+		}
+		if p.NozzleDiameter == 0 {
+			p.NozzleDiameter = proj.NozzleDiameter
+		}
+		sort.Slice(p.Objects, func(i, j int) bool { return p.Objects[i].ID < p.Objects[j].ID })
+		proj.Plates = append(proj.Plates, *p)
+	}
+	sort.Slice(proj.Plates, func(i, j int) bool { return proj.Plates[i].Index < proj.Plates[j].Index })
+
+	for name := range files {
+		if strings.HasPrefix(name, "Metadata/") && strings.EqualFold(path.Ext(name), ".png") {
+			proj.Thumbnails = append(proj.Thumbnails, name)
+		}
+	}
+	sort.Strings(proj.Thumbnails)
+
+	// The slicer's model ID is unambiguous; prefer it to the display name.
+	for _, p := range proj.Plates {
+		if model, ok := modelIDs[p.PrinterModelID]; ok {
+			proj.PrinterModel = model
+			break
+		}
+	}
+
+	if len(proj.Plates) == 0 && proj.Settings == nil {
+		return nil, errors.New("no Bambu Studio metadata found in 3MF")
+	}
+	return proj, nil
+}
+
+var plateJSONName = regexp.MustCompile(`^Metadata/plate_(\d+)\.json$`)
+
+// modelIDs maps slice_info printer_model_id values to model names.
+var modelIDs = map[string]string{
+	"BL-P001": "X1C",
+	"BL-P002": "X1",
+	"C13":     "X1E",
+	"C12":     "P1S",
+	"C11":     "P1P",
+	"N1":      "A1 mini",
+	"N2S":     "A1",
+	"O1D":     "H2D",
+}
+
+// studioModels maps Bambu Studio's printer_model display names, without the
+// "Bambu Lab " prefix, to the names used by modelIDs where they differ.
+var studioModels = map[string]string{
+	"X1 Carbon": "X1C",
+}
+
+func studioModel(name string) string {
+	name = strings.TrimSpace(strings.TrimPrefix(name, "Bambu Lab "))
+	if model, ok := studioModels[name]; ok {
+		return model
+	}
+	return name
+}
+
+// bedTypes maps Bambu Studio's display names to the identifiers the printer
+// expects in project_file.
+var bedTypes = map[string]string{
+	"cool plate":             "cool_plate",
+	"cool plate (supertack)": "supertack_plate",
+	"engineering plate":      "eng_plate",
+	"high temp plate":        "hot_plate",
+	"textured pei plate":     "textured_plate",
+	"textured cool plate":    "textured_cool_plate",
+}
+
+// BedTypeID normalises a bed type to the printer's identifier. Values that
+// already are identifiers are returned unchanged.
+func BedTypeID(name string) string {
+	name = strings.TrimSpace(name)
+	if id, ok := bedTypes[strings.ToLower(name)]; ok {
+		return id
+	}
+	return name
+}
+
+type metadataItem struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func metadata(items []metadataItem, key string) string {
+	for _, m := range items {
+		if m.Key == key {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+type sliceInfo struct {
+	Header []metadataItem `xml:"header>header_item"`
+	Plates []struct {
+		Metadata []metadataItem `xml:"metadata"`
+		Objects  []struct {
+			ID      int    `xml:"identify_id,attr"`
+			Name    string `xml:"name,attr"`
+			Skipped string `xml:"skipped,attr"`
+		} `xml:"object"`
+		Filaments []struct {
+			ID          int    `xml:"id,attr"`
+			TrayInfoIdx string `xml:"tray_info_idx,attr"`
+			Type        string `xml:"type,attr"`
+			Color       string `xml:"color,attr"`
+			UsedM       string `xml:"used_m,attr"`
+			UsedG       string `xml:"used_g,attr"`
+		} `xml:"filament"`
+	} `xml:"plate"`
+}
+
+type modelSettings struct {
+	Objects []struct {
+		ID       string         `xml:"id,attr"`
+		Metadata []metadataItem `xml:"metadata"`
+	} `xml:"object"`
+	Plates []struct {
+		Metadata  []metadataItem `xml:"metadata"`
+		Instances []struct {
+			Metadata []metadataItem `xml:"metadata"`
+		} `xml:"model_instance"`
+	} `xml:"plate"`
+}
+
+type plateJSON struct {
+	BedType        string  `json:"bed_type"`
+	NozzleDiameter float64 `json:"nozzle_diameter"`
+	Objects        []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"bbox_objects"`
+}
+
+func readAll(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func readJSON(f *zip.File, v any) error {
+	data, err := readAll(f)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func readXML(f *zip.File, v any) error {
+	data, err := readAll(f)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func parseFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v
+}
@@ -0,0 +1,106 @@
+package threemf
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// build3MF zips files into an in-memory 3MF.
+func build3MF(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+const x1cSliceInfo = `<?xml version="1.0" encoding="UTF-8"?>
+<config>
+  <header>
+    <header_item key="X-BBL-Client-Type" value="slicer"/>
+    <header_item key="X-BBL-Client-Version" value="01.09.07.52"/>
+  </header>
+  <plate>
+    <metadata key="index" value="1"/>
+    <metadata key="printer_model_id" value="BL-P001"/>
+    <metadata key="nozzle_diameters" value="0.4"/>
+    <metadata key="prediction" value="3600"/>
+    <metadata key="weight" value="12.5"/>
+    <object identify_id="180" name="cube" skipped="false"/>
+    <filament id="1" tray_info_idx="GFA00" type="PLA" color="#FFFFFF" used_m="4.1" used_g="12.5"/>
+  </plate>
+</config>`
+
+func TestReadX1CarbonProject(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"settings and slice info", map[string]string{
+			"Metadata/project_settings.config": `{"printer_model": "Bambu Lab X1 Carbon", "nozzle_diameter": ["0.4"], "curr_bed_type": "Textured PEI Plate"}`,
+			"Metadata/slice_info.config":       x1cSliceInfo,
+		}},
+		{"settings only", map[string]string{
+			"Metadata/project_settings.config": `{"printer_model": "Bambu Lab X1 Carbon", "nozzle_diameter": ["0.4"]}`,
+		}},
+		{"slice info only", map[string]string{
+			"Metadata/slice_info.config": x1cSliceInfo,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := build3MF(t, tt.files)
+			proj, err := Read(r, r.Size())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if proj.PrinterModel != "X1C" {
+				t.Errorf("PrinterModel = %q, want X1C", proj.PrinterModel)
+			}
+		})
+	}
+}
+
+func TestReadPlate(t *testing.T) {
+	r := build3MF(t, map[string]string{
+		"Metadata/project_settings.config": `{"printer_model": "Bambu Lab X1 Carbon", "nozzle_diameter": ["0.4"], "curr_bed_type": "Textured PEI Plate"}`,
+		"Metadata/slice_info.config":       x1cSliceInfo,
+		"Metadata/plate_1.gcode":           "G28\n",
+		"Metadata/plate_1.gcode.md5":       "d41d8cd98f00b204e9800998ecf8427e\n",
+	})
+	proj, err := Read(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proj.SlicerVersion != "01.09.07.52" || proj.BedType != "textured_plate" {
+		t.Errorf("project = %+v", proj)
+	}
+	if len(proj.Plates) != 1 {
+		t.Fatalf("plates = %+v", proj.Plates)
+	}
+	p := proj.Plates[0]
+	if !p.Sliced || p.GcodeFile != "Metadata/plate_1.gcode" || p.GcodeMD5 != "D41D8CD98F00B204E9800998ECF8427E" {
+		t.Errorf("plate = %+v", p)
+	}
+	if p.BedType != "textured_plate" || p.NozzleDiameter != 0.4 || p.PredictionSec != 3600 {
+		t.Errorf("plate = %+v", p)
+	}
+	if len(p.Objects) != 1 || p.Objects[0].ID != 180 || p.Objects[0].Name != "cube" {
+		t.Errorf("objects = %+v", p.Objects)
+	}
+	if len(p.Filaments) != 1 || p.Filaments[0].Type != "PLA" || p.Filaments[0].UsedGrams != 12.5 {
+		t.Errorf("filaments = %+v", p.Filaments)
+	}
+}